@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/listener"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/tracing"
+)
+
+func backfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	configure := configFlags(flags)
+	fromFlag := flags.String("from", "", "first block of the range")
+	toFlag := flags.String("to", "", "last block of the range, defaults to the latest confirmed block")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	configure()
+
+	from, ok := new(big.Int).SetString(*fromFlag, 10)
+	if !ok {
+		return errors.New("-from must be a block number")
+	}
+	var to *big.Int
+	if len(*toFlag) > 0 {
+		if to, ok = new(big.Int).SetString(*toFlag, 10); !ok {
+			return errors.New("-to must be a block number")
+		}
+	}
+
+	logger.Setup()
+	defer logger.Sync()
+	tracing.Setup()
+	defer eth.GetEth().Close()
+
+	/* a stop signal aborts deliveries still in flight, events left are listed */
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	submitted, undelivered, err := listener.NewBackfillListener().Backfill(ctx, from, to)
+	for _, event := range undelivered {
+		event.Logger().Warn("event left undelivered by backfill", logger.Object("event", &event))
+	}
+	fmt.Printf("submitted %d events, %d left undelivered\n", submitted, len(undelivered))
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	tracing.Shutdown(flushCtx)
+	cancel()
+
+	if err != nil {
+		return err
+	}
+	if len(undelivered) > 0 {
+		return fmt.Errorf("%d events were not delivered", len(undelivered))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+)
+
+func config(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: config check [flags]")
+	}
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	configure := configFlags(flags)
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	configure()
+
+	settings, err := conf.Check()
+	if settings != nil {
+		fmt.Println(conf.Dump(settings))
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+type decodedLog struct {
+	LogIndex  *uint          `json:"log_index,omitempty"`
+	Event     string         `json:"event"`
+	Signature string         `json:"signature"`
+	Args      map[string]any `json:"args"`
+}
+
+func decodeLog(args []string) error {
+	flags := flag.NewFlagSet("decode-log", flag.ContinueOnError)
+	topicsFlag := flags.String("topics", "", "comma separated hex topics, the event signature first")
+	dataFlag := flags.String("data", "", "hex data")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	log := types.Log{}
+	for _, topic := range strings.Split(*topicsFlag, ",") {
+		decoded, err := hexutil.Decode(strings.TrimSpace(topic))
+		if err != nil || len(decoded) != common.HashLength {
+			return fmt.Errorf("topic %q is not a 32 byte hex string", topic)
+		}
+		log.Topics = append(log.Topics, common.BytesToHash(decoded))
+	}
+	if len(*dataFlag) > 0 {
+		data, err := hexutil.Decode(*dataFlag)
+		if err != nil {
+			return fmt.Errorf("data is not a hex string: %w", err)
+		}
+		log.Data = data
+	}
+
+	contractABI, err := eth.ParseABI()
+	if err != nil {
+		return err
+	}
+	decoded, err := decode(contractABI, log)
+	if err != nil {
+		return err
+	}
+	return printJSON(decoded)
+}
+
+func decodeTx(args []string) error {
+	flags := flag.NewFlagSet("decode-tx", flag.ContinueOnError)
+	configure := configFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	configure()
+	if flags.NArg() != 1 {
+		return errors.New("a transaction hash is required")
+	}
+	txHash, err := hexutil.Decode(flags.Arg(0))
+	if err != nil || len(txHash) != common.HashLength {
+		return fmt.Errorf("%q is not a transaction hash", flags.Arg(0))
+	}
+
+	logger.Setup()
+	defer logger.Sync()
+	eth := eth.GetEth()
+	defer eth.Close()
+	receipt, err := eth.Client.TransactionReceipt(context.Background(), common.BytesToHash(txHash))
+	if err != nil {
+		return fmt.Errorf("could not get transaction receipt: %w", err)
+	}
+
+	contractAddress := common.HexToAddress(conf.GetConf().ContractAddress())
+	events := []decodedLog{}
+	for _, log := range receipt.Logs {
+		if log.Address != contractAddress || len(log.Topics) == 0 {
+			continue
+		}
+		decoded, err := decode(eth.ABI, *log)
+		if err != nil {
+			return fmt.Errorf("could not decode log %d: %w", log.Index, err)
+		}
+		logIndex := log.Index
+		decoded.LogIndex = &logIndex
+		events = append(events, decoded)
+	}
+
+	return printJSON(map[string]any{
+		"tx_hash":      receipt.TxHash.Hex(),
+		"block_number": receipt.BlockNumber.String(),
+		"block_hash":   receipt.BlockHash.Hex(),
+		"status":       receipt.Status,
+		"events":       events,
+	})
+}
+
+/* unpacks indexed arguments from topics and the others from data */
+func decode(contractABI *abi.ABI, log types.Log) (decodedLog, error) {
+	if len(log.Topics) == 0 {
+		return decodedLog{}, errors.New("log has no topics")
+	}
+	event, err := contractABI.EventByID(log.Topics[0])
+	if err != nil {
+		return decodedLog{}, err
+	}
+
+	args := map[string]any{}
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(args, log.Data); err != nil {
+		return decodedLog{}, err
+	}
+	indexed := abi.Arguments{}
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:]); err != nil {
+		return decodedLog{}, err
+	}
+
+	for name, value := range args {
+		args[name] = printable(value)
+	}
+	return decodedLog{Event: event.Name, Signature: event.Sig, Args: args}, nil
+}
+
+/* renders addresses and numbers as strings, and bytes as text when they are printable */
+func printable(value any) any {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return bytesToText(v)
+	}
+
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() == reflect.Array && reflected.Type().Elem().Kind() == reflect.Uint8 {
+		bytes := make([]byte, reflected.Len())
+		reflect.Copy(reflect.ValueOf(bytes), reflected)
+		return bytesToText(bytes)
+	}
+	return value
+}
+
+func bytesToText(bytes []byte) string {
+	text := string(bytes)
+	if !utf8.ValidString(text) {
+		return hexutil.Encode(bytes)
+	}
+	for _, r := range text {
+		if !unicode.IsPrint(r) {
+			return hexutil.Encode(bytes)
+		}
+	}
+	return text
+}
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+)
+
+/* adds -config, -profile and a flag per configuration key but secrets, the returned function applies them once flags are parsed */
+func configFlags(flags *flag.FlagSet) func() {
+	path := flags.String("config", envOr("CONFIG_PATH", "application.conf"), "base configuration file, or CONFIG_PATH")
+	profile := flags.String("profile", os.Getenv("CONFIG_PROFILE"), "profile layered over the base file, read from application.<profile>.conf, or CONFIG_PROFILE")
+	overrides := map[string]string{}
+	for _, key := range conf.FlagKeys() {
+		key := key
+		flags.Func(key, "overrides "+key, func(value string) error {
+			overrides[key] = value
+			return nil
+		})
+	}
+
+	return func() {
+		conf.Configure(conf.Options{Path: *path, Profile: *profile, Overrides: overrides})
+	}
+}
+
+func envOr(name string, fallback string) string {
+	if value, set := os.LookupEnv(name); set {
+		return value
+	}
+	return fallback
+}
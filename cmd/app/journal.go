@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/sergera/star-notary-listener/internal/journal"
+)
+
+func verifyJournal(args []string) error {
+	flags := flag.NewFlagSet("verify-journal", flag.ContinueOnError)
+	configure := configFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return errors.New("usage: verify-journal [flags] [file]")
+	}
+
+	/* the configuration is only needed to find the journal when no file is given */
+	path := flags.Arg(0)
+	if len(path) == 0 {
+		configure()
+		path = journal.Path()
+	}
+
+	verification, err := journal.Verify(path)
+	fmt.Printf("%d entries, last hash %s\n", verification.Entries, verification.LastHash)
+	return err
+}
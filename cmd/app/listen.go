@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sergera/star-notary-listener/internal/admin"
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/listener"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/reconciler"
+	"github.com/sergera/star-notary-listener/internal/reload"
+	"github.com/sergera/star-notary-listener/internal/tracing"
+)
+
+func listen(args []string) error {
+	flags := flag.NewFlagSet("listen", flag.ContinueOnError)
+	configure := configFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	configure()
+
+	logger.Setup()
+	defer logger.Sync()
+	tracing.Setup()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go reload.NewWatcher().Run(ctx)
+
+	listener := listener.NewListener()
+	if conf.GetConf().ReconciliationEnabled() {
+		reconciler := reconciler.NewReconciler(listener.Projection())
+		go reconciler.Run(ctx)
+	}
+	var server *admin.Server
+	if conf.GetConf().AdminEnabled() {
+		server = admin.NewServer(listener)
+		server.Start()
+	}
+	listener.Listen(ctx)
+
+	if server != nil {
+		/* kept up while draining, so probes see the listener as not ready */
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		server.Shutdown(shutdownCtx)
+		cancel()
+	}
+
+	eth.GetEth().Close()
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	tracing.Shutdown(flushCtx)
+	cancel()
+	logger.Info("shutdown complete")
+	return nil
+}
@@ -1,13 +1,96 @@
 package main
 
 import (
-	"github.com/sergera/star-notary-listener/internal/listener"
-	"github.com/sergera/star-notary-listener/internal/logger"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
 )
 
+type command struct {
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"listen": {
+		usage:   "listen [flags]",
+		summary: "listen to contract events and deliver them once confirmed",
+		run:     listen,
+	},
+	"backfill": {
+		usage:   "backfill [flags] -from <block> [-to <block>]",
+		summary: "deliver every event of a confirmed block range and exit",
+		run:     backfill,
+	},
+	"decode-log": {
+		usage:   "decode-log -topics <topic,...> [-data <hex>]",
+		summary: "decode a raw log with the contract ABI, without connecting to the RPC provider",
+		run:     decodeLog,
+	},
+	"decode-tx": {
+		usage:   "decode-tx [flags] <tx hash>",
+		summary: "decode every contract event emitted by a transaction",
+		run:     decodeTx,
+	},
+	"star": {
+		usage:   "star [flags] [-block <block>] <token id>",
+		summary: "print the on-chain state of a star",
+		run:     star,
+	},
+	"verify-journal": {
+		usage:   "verify-journal [flags] [file]",
+		summary: "check the delivery journal for gaps and tampering",
+		run:     verifyJournal,
+	},
+	"config": {
+		usage:   "config check [flags]",
+		summary: "validate the configuration and print the effective values",
+		run:     config,
+	},
+}
+
+/* runs the listener when no command is given, as before commands existed */
 func main() {
-	logger.Setup()
-	defer logger.Sync()
-	listener := listener.NewListener()
-	listener.Listen()
+	name, args := "listen", []string{}
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return
+	}
+	command, found := commands[name]
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err := command.run(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "error:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: star-notary-listener <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-53s %s\n", commands[name].usage, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "flags are -config <file>, -profile <name> and -<key> <value> for any configuration key, as in -delivery.workers 8")
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+func star(args []string) error {
+	flags := flag.NewFlagSet("star", flag.ContinueOnError)
+	configure := configFlags(flags)
+	blockFlag := flags.String("block", "", "block to read the state at, defaults to latest")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	configure()
+	if flags.NArg() != 1 {
+		return errors.New("a token id is required")
+	}
+	tokenId, ok := new(big.Int).SetString(flags.Arg(0), 10)
+	if !ok {
+		return fmt.Errorf("%q is not a token id", flags.Arg(0))
+	}
+	opts := &bind.CallOpts{Context: context.Background()}
+	if len(*blockFlag) > 0 {
+		if opts.BlockNumber, ok = new(big.Int).SetString(*blockFlag, 10); !ok {
+			return errors.New("-block must be a block number")
+		}
+	}
+
+	logger.Setup()
+	defer logger.Sync()
+	defer eth.GetEth().Close()
+	contract := eth.GetEth().Contract
+
+	owner, err := contract.OwnerOf(opts, tokenId)
+	if err != nil {
+		return fmt.Errorf("could not get owner, the star might not exist: %w", err)
+	}
+	star, err := contract.TokenIdToStar(opts, tokenId)
+	if err != nil {
+		return fmt.Errorf("could not get star: %w", err)
+	}
+	priceInWei, err := contract.TokenIdToSalePrice(opts, tokenId)
+	if err != nil {
+		return fmt.Errorf("could not get sale price: %w", err)
+	}
+	tokenURI, err := contract.TokenURI(opts, tokenId)
+	if err != nil {
+		return fmt.Errorf("could not get token uri: %w", err)
+	}
+
+	/* coordinates are concatenated the way create events carry them */
+	coordinates := string(star.RAHours[:]) + string(star.RAMinutes[:]) + string(star.RASeconds[:]) +
+		string(star.DecDegrees[:]) + string(star.DecArcMinutes[:]) + string(star.DecArcSeconds[:])
+
+	return printJSON(map[string]any{
+		"token_id":       tokenId.String(),
+		"name":           bytesToText(star.Name),
+		"coordinates":    bytesToText([]byte(coordinates)),
+		"owner":          owner.Hex(),
+		"for_sale":       priceInWei.Sign() > 0,
+		"price_in_wei":   priceInWei.String(),
+		"price_in_ether": eth.WeiToEther(priceInWei).Text('f', 18),
+		"token_uri":      tokenURI,
+	})
+}
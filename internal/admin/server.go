@@ -0,0 +1,214 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/listener"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+/* serves probes, status, metrics and operations of a running listener */
+type Server struct {
+	server   *http.Server
+	listener *listener.Listener
+	token    string
+}
+
+func NewServer(listener *listener.Listener) *Server {
+	s := &Server{listener: listener, token: conf.GetConf().AdminToken()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/status", s.status)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/admin/pause", s.authenticated(http.MethodPost, s.pause))
+	mux.HandleFunc("/admin/resume", s.authenticated(http.MethodPost, s.resume))
+	mux.HandleFunc("/admin/replay", s.authenticated(http.MethodPost, s.replay))
+	mux.HandleFunc("/admin/redeliver", s.authenticated(http.MethodPost, s.redeliver))
+	mux.HandleFunc("/admin/retry-failed", s.authenticated(http.MethodPost, s.retryFailed))
+	mux.HandleFunc("/admin/drop-failed", s.authenticated(http.MethodPost, s.dropFailed))
+	mux.HandleFunc("/admin/checkpoint", s.authenticated("", s.checkpoint))
+	s.server = &http.Server{
+		Addr:              ":" + conf.GetConf().AdminPort(),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+func (s *Server) Start() {
+	go func() {
+		logger.Info("serving admin endpoints", logger.String("address", s.server.Addr))
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("admin server failed", logger.String("message", err.Error()))
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		logger.Error("could not shut down admin server", logger.String("message", err.Error()))
+	}
+}
+
+/* alive as long as the process can answer */
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	reasons := s.listener.Ready(r.Context())
+	if len(reasons) == 0 {
+		respond(w, http.StatusOK, map[string]any{"ready": true})
+		return
+	}
+
+	messages := make([]string, len(reasons))
+	for i, reason := range reasons {
+		messages[i] = reason.Error()
+	}
+	respond(w, http.StatusServiceUnavailable, map[string]any{"ready": false, "reasons": messages})
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, s.listener.Status(r.Context()))
+}
+
+/* operations require the admin token, and are disabled when none is configured */
+func (s *Server) authenticated(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.token) == 0 {
+			respondError(w, http.StatusForbidden, errors.New("admin operations are disabled, no admin token is configured"))
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			respondError(w, http.StatusUnauthorized, errors.New("invalid admin token"))
+			return
+		}
+		if len(method) > 0 && r.Method != method {
+			respondError(w, http.StatusMethodNotAllowed, fmt.Errorf("method must be %s", method))
+			return
+		}
+
+		logger.Info("admin operation", logger.String("method", r.Method), logger.String("path", r.URL.Path), logger.String("query", r.URL.RawQuery))
+		handler(w, r)
+	}
+}
+
+func (s *Server) pause(w http.ResponseWriter, r *http.Request) {
+	s.listener.Pause()
+	respond(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+func (s *Server) resume(w http.ResponseWriter, r *http.Request) {
+	s.listener.Resume()
+	respond(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+func (s *Server) replay(w http.ResponseWriter, r *http.Request) {
+	from, err := blockParam(r, "from")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := blockParam(r, "to")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	submitted, err := s.listener.Replay(r.Context(), from, to)
+	if err != nil {
+		respondError(w, http.StatusConflict, err)
+		return
+	}
+	respond(w, http.StatusOK, map[string]int{"submitted": submitted})
+}
+
+func (s *Server) redeliver(w http.ResponseWriter, r *http.Request) {
+	txHash := r.URL.Query().Get("tx")
+	if len(txHash) == 0 {
+		respondError(w, http.StatusBadRequest, errors.New("tx is required"))
+		return
+	}
+	logIndex, err := strconv.ParseUint(r.URL.Query().Get("log_index"), 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("log_index must be an integer"))
+		return
+	}
+
+	if err := s.listener.Redeliver(r.Context(), txHash, uint(logIndex)); err != nil {
+		respondError(w, http.StatusConflict, err)
+		return
+	}
+	respond(w, http.StatusOK, map[string]int{"submitted": 1})
+}
+
+func (s *Server) retryFailed(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, map[string]int{"submitted": s.listener.RetryFailed()})
+}
+
+func (s *Server) dropFailed(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, map[string]int{"dropped": s.listener.DropFailed()})
+}
+
+func (s *Server) checkpoint(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		block, found := s.listener.Checkpoint()
+		if !found {
+			respond(w, http.StatusOK, map[string]any{"block": nil})
+			return
+		}
+		respond(w, http.StatusOK, map[string]string{"block": block.String()})
+	case http.MethodPut:
+		block, err := blockParam(r, "block")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.listener.SetCheckpoint(r.Context(), block); err != nil {
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, listener.ErrCheckpointDisabled) || errors.Is(err, listener.ErrBackfillRunning) {
+				statusCode = http.StatusConflict
+			}
+			respondError(w, statusCode, err)
+			return
+		}
+		respond(w, http.StatusOK, map[string]string{"block": block.String()})
+	default:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method must be GET or PUT"))
+	}
+}
+
+func blockParam(r *http.Request, name string) (*big.Int, error) {
+	block, ok := new(big.Int).SetString(r.URL.Query().Get(name), 10)
+	if !ok || block.Sign() < 0 {
+		return nil, fmt.Errorf("%s must be a block number", name)
+	}
+	return block, nil
+}
+
+func respondError(w http.ResponseWriter, statusCode int, err error) {
+	respond(w, statusCode, map[string]string{"error": err.Error()})
+}
+
+func respond(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("could not encode admin response", logger.String("message", err.Error()))
+	}
+}
@@ -0,0 +1,87 @@
+package checkpoint
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+const checkpointFileName = "checkpoint"
+
+/* block through which every event was delivered, ingestion resumes after it on start */
+type Checkpoint struct {
+	lock  *sync.Mutex
+	path  string
+	block *big.Int
+}
+
+func NewCheckpoint() *Checkpoint {
+	c := &Checkpoint{
+		lock: &sync.Mutex{},
+		path: filepath.Join(conf.GetConf().CheckpointPath(), checkpointFileName),
+	}
+	c.load()
+	return c
+}
+
+func (c *Checkpoint) load() {
+	content, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.Panic("could not read checkpoint", logger.String("message", err.Error()))
+	}
+
+	block, ok := new(big.Int).SetString(strings.TrimSpace(string(content)), 10)
+	if !ok {
+		logger.Panic("could not parse checkpoint", logger.String("content", string(content)))
+	}
+	c.block = block
+	logger.Info("loaded checkpoint", logger.String("block", block.String()))
+}
+
+/* the checkpoint block, false if none was saved yet */
+func (c *Checkpoint) Block() (*big.Int, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.block == nil {
+		return nil, false
+	}
+	return new(big.Int).Set(c.block), true
+}
+
+/* writes the block atomically, skipping the write if it did not change */
+func (c *Checkpoint) Save(block *big.Int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.block != nil && c.block.Cmp(block) == 0 {
+		return nil
+	}
+
+	tmpPath := c.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(block.String() + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return err
+	}
+
+	c.block = new(big.Int).Set(block)
+	return nil
+}
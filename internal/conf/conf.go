@@ -1,150 +1,410 @@
 package conf
 
 import (
+	"fmt"
 	"log"
-	"strconv"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/gurkankaymak/hocon"
 )
 
+const configFile = "application.conf"
+
 var once sync.Once
 var instance *conf
 
+/* where the configuration is read from, keys are taken from overrides, then environment variables, then the profile and base files */
+type Options struct {
+	/* base configuration file */
+	Path string
+	/* name of a profile file layered over the base file, application.<profile>.conf for application.conf, none if empty */
+	Profile string
+	/* values of keys set on the command line */
+	Overrides map[string]string
+}
+
+var options = Options{Path: configFile}
+
+/* sets where the configuration is read from, must be called before the first GetConf */
+func Configure(o Options) {
+	if len(o.Path) == 0 {
+		o.Path = configFile
+	}
+	options = o
+}
+
+/* a parsed configuration file */
+type layer struct {
+	path   string
+	config *hocon.Config
+}
+
 type conf struct {
-	hocon                    *hocon.Config
 	rpcProviderWebsocketURL  string
 	contractAddress          string
 	confirmationBlocks       uint64
 	confirmationSleepSeconds uint64
+	confirmationPolicy       string
+	confirmationSeconds      uint64
 	starNotaryAPIHost        string
 	starNotaryAPIPort        string
+	starNotaryAPITimeout     uint64
+	journalEnabled           bool
+	journalPath              string
 	logPath                  string
+	reconciliationEnabled    bool
+	reconciliationInterval   uint64
+	reconciliationSampleSize uint64
+	reconciliationCorrect    bool
+	enrichmentEnabled        bool
+	enrichmentCacheSize      uint64
+	metadataEnabled          bool
+	metadataIPFSGateway      string
+	metadataTimeoutSeconds   uint64
+	metadataCacheSize        uint64
+	metadataNegativeSeconds  uint64
+	transactionsEnabled      bool
+	headerCacheSize          uint64
+	queueCapacity            uint64
+	queueDurable             bool
+	queuePath                string
+	queueCompactAfter        uint64
+	deliveryWorkers          uint64
+	deliveryRetrySeconds     uint64
+	deliveryMaxAttempts      uint64
+	deliveryTwoPhase         bool
+	shutdownTimeoutSeconds   uint64
+	adminEnabled             bool
+	adminPort                string
+	tracingExporter          string
+	tracingPath              string
+	tracingOTLPEndpoint      string
+	adminToken               string
+	checkpointEnabled        bool
+	checkpointPath           string
+	logLevel                 string
+	logConsoleFormat         string
+	logFileEnabled           bool
+	logFileFormat            string
+	logMaxSizeMB             uint64
+	logMaxAgeDays            uint64
+	logMaxBackups            uint64
+	logCompress              bool
+	logSampleInitial         uint64
+	logSampleThereafter      uint64
+	sources                  map[string]string
+	/* guards keys that can be reloaded */
+	lock *sync.RWMutex
 }
 
 func GetConf() *conf {
 	once.Do(func() {
-		var c *conf = &conf{}
-		c.setup()
+		c, err := load()
+		if c != nil {
+			log.Printf("configurations:\n%s", Dump(c.Settings()))
+		}
+		if err != nil {
+			log.Panic(err.Error())
+		}
 		instance = c
 	})
 	return instance
 }
 
-func (c *conf) setup() {
-	c.setConfig()
-	c.setRPCProviderWebsocketURL()
-	c.setContractAddress()
-	c.setConfirmationBlocks()
-	c.setConfirmationSleepSeconds()
-	c.setStarNotaryAPIHost()
-	c.setStarNotaryAPIPort()
-	c.setLogPath()
+/* validates the configuration without keeping it, returns the effective values even if some are invalid */
+func Check() ([]Setting, error) {
+	c, err := load()
+	if c == nil {
+		return nil, err
+	}
+	return c.Settings(), err
 }
 
-func (c *conf) setConfig() {
-	hocon, err := hocon.ParseResource("application.conf")
-	if err != nil {
-		log.Panic("could not parse configuration file: ", err.Error())
+/* parses the configuration files and validates every key, reporting all errors at once */
+func load() (*conf, error) {
+	/* later layers take precedence */
+	layers := []layer{}
+	for _, path := range Files() {
+		config, err := hocon.ParseResource(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse configuration file %s: %w", path, err)
+		}
+		layers = append(layers, layer{path: path, config: config})
+	}
+
+	c := &conf{sources: map[string]string{}, lock: &sync.RWMutex{}}
+	if err := c.validate(layers, options.Overrides); err != nil {
+		return c, err
 	}
+	return c, nil
+}
 
-	log.Printf("configurations: %+v", *hocon)
+/* applies changed keys that are safe to change while running, keys needing a restart are returned as rejected and left unchanged */
+/* nothing is applied if the configuration is invalid */
+func Reload() (applied []Setting, rejected []string, err error) {
+	current := GetConf()
+	next, err := load()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	c.hocon = hocon
+	current.lock.Lock()
+	defer current.lock.Unlock()
+	for _, f := range schema {
+		value := f.format(next)
+		if value == f.format(current) {
+			continue
+		}
+		if !f.reloadable {
+			rejected = append(rejected, f.key)
+			continue
+		}
+		f.parse(current, value)
+		current.sources[f.key] = next.sources[f.key]
+		if f.secret {
+			value = redact(value)
+		}
+		applied = append(applied, Setting{Key: f.key, Value: value, Source: next.sources[f.key]})
+	}
+	return applied, rejected, nil
 }
 
-func (c *conf) setRPCProviderWebsocketURL() {
-	rpcProviderWebsocketURL := c.hocon.GetString("rpc-provider.websocket-url")
-	if len(rpcProviderWebsocketURL) == 0 {
-		log.Panic("infura websocket url environment variable not found")
+/* files the configuration is read from, base file first */
+func Files() []string {
+	if len(options.Profile) == 0 {
+		return []string{options.Path}
 	}
+	return []string{options.Path, ProfilePath(options.Path, options.Profile)}
+}
 
-	c.rpcProviderWebsocketURL = rpcProviderWebsocketURL
+/* profile files sit next to the base file, named after it */
+func ProfilePath(path string, profile string) string {
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "." + profile + extension
 }
 
 func (c *conf) RPCProviderWebsocketURL() string {
 	return c.rpcProviderWebsocketURL
 }
 
-func (c *conf) setContractAddress() {
-	contractAddress := c.hocon.GetString("contract.address")
-	if len(contractAddress) == 0 {
-		log.Panic("contract address environment variable not found")
-	}
+func (c *conf) ContractAddress() string {
+	return c.contractAddress
+}
 
-	c.contractAddress = contractAddress
+func (c *conf) ConfirmationBlocks() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.confirmationBlocks
 }
 
-func (c *conf) ContractAddress() string {
-	return c.contractAddress
+func (c *conf) ConfirmationSleepSeconds() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.confirmationSleepSeconds
 }
 
-func (c *conf) setConfirmationBlocks() {
-	confirmationBlocksString := c.hocon.GetString("confirmation.blocks")
-	if len(confirmationBlocksString) == 0 {
-		log.Panic("confirmed threshold environment variable not found")
-	}
+func (c *conf) ConfirmationPolicy() string {
+	return c.confirmationPolicy
+}
 
-	confirmationBlocks, err := strconv.ParseUint(confirmationBlocksString, 10, 64)
-	if err != nil {
-		log.Panic("could not convert confirmed threshold environment variable to uint: ", err.Error())
-	}
+func (c *conf) ConfirmationSeconds() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.confirmationSeconds
+}
 
-	c.confirmationBlocks = confirmationBlocks
+func (c *conf) StarNotaryAPIHost() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.starNotaryAPIHost
 }
 
-func (c *conf) ConfirmationBlocks() uint64 {
-	return c.confirmationBlocks
+func (c *conf) StarNotaryAPIPort() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.starNotaryAPIPort
 }
 
-func (c *conf) setConfirmationSleepSeconds() {
-	confirmationSleepSecondsString := c.hocon.GetString("confirmation.sleep-seconds")
-	if len(confirmationSleepSecondsString) == 0 {
-		log.Panic("sleep interval seconds environment variable not found")
-	}
+func (c *conf) StarNotaryAPITimeoutSeconds() uint64 {
+	return c.starNotaryAPITimeout
+}
 
-	confirmationSleepSeconds, err := strconv.ParseUint(confirmationSleepSecondsString, 10, 64)
-	if err != nil {
-		log.Panic("could not convert sleep interval seconds environment variable to uint: ", err.Error())
-	}
+func (c *conf) LogPath() string {
+	return c.logPath
+}
 
-	c.confirmationSleepSeconds = confirmationSleepSeconds
+func (c *conf) ReconciliationEnabled() bool {
+	return c.reconciliationEnabled
 }
 
-func (c *conf) ConfirmationSleepSeconds() uint64 {
-	return c.confirmationSleepSeconds
+func (c *conf) ReconciliationIntervalSeconds() uint64 {
+	return c.reconciliationInterval
 }
 
-func (c *conf) setStarNotaryAPIHost() {
-	starNotaryAPIHost := c.hocon.GetString("star-notary-api.host")
-	if len(starNotaryAPIHost) == 0 {
-		log.Panic("star notary api host environment variable not found")
-	}
+func (c *conf) ReconciliationSampleSize() uint64 {
+	return c.reconciliationSampleSize
+}
 
-	c.starNotaryAPIHost = starNotaryAPIHost
+func (c *conf) ReconciliationEmitCorrections() bool {
+	return c.reconciliationCorrect
 }
 
-func (c *conf) StarNotaryAPIHost() string {
-	return c.starNotaryAPIHost
+func (c *conf) EnrichmentEnabled() bool {
+	return c.enrichmentEnabled
 }
 
-func (c *conf) setStarNotaryAPIPort() {
-	starNotaryAPIPort := c.hocon.GetString("star-notary-api.port")
-	if len(starNotaryAPIPort) == 0 {
-		log.Panic("star notary api port environment variable not found")
-	}
+func (c *conf) EnrichmentCacheSize() uint64 {
+	return c.enrichmentCacheSize
+}
 
-	c.starNotaryAPIPort = starNotaryAPIPort
+func (c *conf) MetadataEnabled() bool {
+	return c.metadataEnabled
 }
 
-func (c *conf) StarNotaryAPIPort() string {
-	return c.starNotaryAPIPort
+func (c *conf) MetadataIPFSGateway() string {
+	return c.metadataIPFSGateway
 }
 
-func (c *conf) setLogPath() {
-	c.logPath = c.hocon.GetString("log.path")
+func (c *conf) MetadataTimeoutSeconds() uint64 {
+	return c.metadataTimeoutSeconds
 }
 
-func (c *conf) LogPath() string {
-	return c.logPath
+func (c *conf) MetadataCacheSize() uint64 {
+	return c.metadataCacheSize
+}
+
+func (c *conf) MetadataNegativeCacheSeconds() uint64 {
+	return c.metadataNegativeSeconds
+}
+
+func (c *conf) TransactionsEnabled() bool {
+	return c.transactionsEnabled
+}
+
+func (c *conf) RPCProviderHeaderCacheSize() uint64 {
+	return c.headerCacheSize
+}
+
+func (c *conf) QueueCapacity() uint64 {
+	return c.queueCapacity
+}
+
+func (c *conf) QueueDurable() bool {
+	return c.queueDurable
+}
+
+func (c *conf) QueuePath() string {
+	return c.queuePath
+}
+
+func (c *conf) QueueCompactAfter() uint64 {
+	return c.queueCompactAfter
+}
+
+func (c *conf) DeliveryWorkers() uint64 {
+	return c.deliveryWorkers
+}
+
+func (c *conf) DeliveryRetrySeconds() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.deliveryRetrySeconds
+}
+
+func (c *conf) DeliveryMaxAttempts() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.deliveryMaxAttempts
+}
+
+func (c *conf) DeliveryTwoPhase() bool {
+	return c.deliveryTwoPhase
+}
+
+func (c *conf) ShutdownTimeoutSeconds() uint64 {
+	return c.shutdownTimeoutSeconds
+}
+
+func (c *conf) AdminEnabled() bool {
+	return c.adminEnabled
+}
+
+func (c *conf) AdminPort() string {
+	return c.adminPort
+}
+
+func (c *conf) TracingExporter() string {
+	return c.tracingExporter
+}
+
+func (c *conf) TracingPath() string {
+	return c.tracingPath
+}
+
+func (c *conf) TracingOTLPEndpoint() string {
+	return c.tracingOTLPEndpoint
+}
+
+func (c *conf) AdminToken() string {
+	return c.adminToken
+}
+
+func (c *conf) CheckpointEnabled() bool {
+	return c.checkpointEnabled
+}
+
+func (c *conf) CheckpointPath() string {
+	return c.checkpointPath
+}
+
+func (c *conf) LogLevel() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.logLevel
+}
+
+func (c *conf) LogConsoleFormat() string {
+	return c.logConsoleFormat
+}
+
+func (c *conf) LogFileEnabled() bool {
+	return c.logFileEnabled
+}
+
+func (c *conf) LogFileFormat() string {
+	return c.logFileFormat
+}
+
+func (c *conf) LogMaxSizeMB() uint64 {
+	return c.logMaxSizeMB
+}
+
+func (c *conf) LogMaxAgeDays() uint64 {
+	return c.logMaxAgeDays
+}
+
+func (c *conf) LogMaxBackups() uint64 {
+	return c.logMaxBackups
+}
+
+func (c *conf) LogCompress() bool {
+	return c.logCompress
+}
+
+func (c *conf) LogSampleInitial() uint64 {
+	return c.logSampleInitial
+}
+
+func (c *conf) LogSampleThereafter() uint64 {
+	return c.logSampleThereafter
+}
+
+func (c *conf) JournalEnabled() bool {
+	return c.journalEnabled
+}
+
+func (c *conf) JournalPath() string {
+	return c.journalPath
 }
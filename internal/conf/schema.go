@@ -0,0 +1,494 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const unbounded = math.MaxUint64
+
+const redacted = "********"
+
+/* a configuration key, how it is read from its value and where the value came from */
+type field struct {
+	key      string
+	env      string
+	optional bool
+	secret   bool
+	/* applied while running when the configuration is reloaded */
+	reloadable bool
+	parse      func(c *conf, value string) error
+	format     func(c *conf) string
+}
+
+/* every key, in the order of the configuration file */
+var schema = []field{
+	stringField("contract.address", "CONTRACT_ADDRESS", isAddress, func(c *conf) *string { return &c.contractAddress }),
+	stringField("confirmation.policy", "CONFIRMATION_POLICY", isOneOf("depth", "safe", "finalized", "time"), func(c *conf) *string { return &c.confirmationPolicy }),
+	uintField("confirmation.blocks", "CONFIRMATION_BLOCKS", 0, unbounded, func(c *conf) *uint64 { return &c.confirmationBlocks }).asReloadable(),
+	uintField("confirmation.sleep-seconds", "CONFIRMATION_SLEEP_SECONDS", 1, unbounded, func(c *conf) *uint64 { return &c.confirmationSleepSeconds }).asReloadable(),
+	uintField("confirmation.seconds", "CONFIRMATION_SECONDS", 0, unbounded, func(c *conf) *uint64 { return &c.confirmationSeconds }).asReloadable(),
+	uintField("queue.capacity", "QUEUE_CAPACITY", 0, unbounded, func(c *conf) *uint64 { return &c.queueCapacity }),
+	boolField("queue.durable", "QUEUE_DURABLE", func(c *conf) *bool { return &c.queueDurable }),
+	stringField("queue.path", "QUEUE_PATH", nil, func(c *conf) *string { return &c.queuePath }).asOptional(),
+	uintField("queue.compact-after", "QUEUE_COMPACT_AFTER", 0, unbounded, func(c *conf) *uint64 { return &c.queueCompactAfter }),
+	boolField("checkpoint.enabled", "CHECKPOINT_ENABLED", func(c *conf) *bool { return &c.checkpointEnabled }),
+	stringField("checkpoint.path", "CHECKPOINT_PATH", nil, func(c *conf) *string { return &c.checkpointPath }).asOptional(),
+	stringField("rpc-provider.websocket-url", "RPC_PROVIDER_WEBSOCKET_URL", isURL("ws", "wss"), func(c *conf) *string { return &c.rpcProviderWebsocketURL }).asSecret(),
+	uintField("rpc-provider.header-cache-size", "RPC_PROVIDER_HEADER_CACHE_SIZE", 1, unbounded, func(c *conf) *uint64 { return &c.headerCacheSize }),
+	stringField("star-notary-api.host", "STAR_NOTARY_API_HOST", isAPIHost, func(c *conf) *string { return &c.starNotaryAPIHost }).asReloadable(),
+	stringField("star-notary-api.port", "STAR_NOTARY_API_PORT", isPort, func(c *conf) *string { return &c.starNotaryAPIPort }).asReloadable(),
+	uintField("star-notary-api.timeout-seconds", "STAR_NOTARY_API_TIMEOUT_SECONDS", 1, unbounded, func(c *conf) *uint64 { return &c.starNotaryAPITimeout }),
+	uintField("delivery.workers", "DELIVERY_WORKERS", 1, 1024, func(c *conf) *uint64 { return &c.deliveryWorkers }),
+	uintField("delivery.retry-seconds", "DELIVERY_RETRY_SECONDS", 0, unbounded, func(c *conf) *uint64 { return &c.deliveryRetrySeconds }).asReloadable(),
+	uintField("delivery.max-attempts", "DELIVERY_MAX_ATTEMPTS", 0, unbounded, func(c *conf) *uint64 { return &c.deliveryMaxAttempts }).asReloadable(),
+	boolField("delivery.two-phase", "DELIVERY_TWO_PHASE", func(c *conf) *bool { return &c.deliveryTwoPhase }),
+	boolField("admin.enabled", "ADMIN_ENABLED", func(c *conf) *bool { return &c.adminEnabled }),
+	stringField("admin.port", "ADMIN_PORT", isPort, func(c *conf) *string { return &c.adminPort }),
+	stringField("admin.token", "ADMIN_TOKEN", nil, func(c *conf) *string { return &c.adminToken }).asOptional().asSecret(),
+	uintField("shutdown.timeout-seconds", "SHUTDOWN_TIMEOUT_SECONDS", 0, unbounded, func(c *conf) *uint64 { return &c.shutdownTimeoutSeconds }),
+	boolField("reconciliation.enabled", "RECONCILIATION_ENABLED", func(c *conf) *bool { return &c.reconciliationEnabled }),
+	uintField("reconciliation.interval-seconds", "RECONCILIATION_INTERVAL_SECONDS", 0, unbounded, func(c *conf) *uint64 { return &c.reconciliationInterval }),
+	uintField("reconciliation.sample-size", "RECONCILIATION_SAMPLE_SIZE", 0, unbounded, func(c *conf) *uint64 { return &c.reconciliationSampleSize }),
+	boolField("reconciliation.emit-corrections", "RECONCILIATION_EMIT_CORRECTIONS", func(c *conf) *bool { return &c.reconciliationCorrect }),
+	boolField("enrichment.enabled", "ENRICHMENT_ENABLED", func(c *conf) *bool { return &c.enrichmentEnabled }),
+	uintField("enrichment.cache-size", "ENRICHMENT_CACHE_SIZE", 1, unbounded, func(c *conf) *uint64 { return &c.enrichmentCacheSize }),
+	boolField("metadata.enabled", "METADATA_ENABLED", func(c *conf) *bool { return &c.metadataEnabled }),
+	stringField("metadata.ipfs-gateway", "METADATA_IPFS_GATEWAY", isURL("http", "https"), func(c *conf) *string { return &c.metadataIPFSGateway }),
+	uintField("metadata.timeout-seconds", "METADATA_TIMEOUT_SECONDS", 1, unbounded, func(c *conf) *uint64 { return &c.metadataTimeoutSeconds }),
+	uintField("metadata.cache-size", "METADATA_CACHE_SIZE", 1, unbounded, func(c *conf) *uint64 { return &c.metadataCacheSize }),
+	uintField("metadata.negative-cache-seconds", "METADATA_NEGATIVE_CACHE_SECONDS", 0, unbounded, func(c *conf) *uint64 { return &c.metadataNegativeSeconds }),
+	boolField("transactions.enabled", "TRANSACTIONS_ENABLED", func(c *conf) *bool { return &c.transactionsEnabled }),
+	stringField("tracing.exporter", "TRACING_EXPORTER", isOneOf("none", "stdout", "file", "otlp"), func(c *conf) *string { return &c.tracingExporter }),
+	stringField("tracing.path", "TRACING_PATH", nil, func(c *conf) *string { return &c.tracingPath }).asOptional(),
+	stringField("tracing.otlp-endpoint", "TRACING_OTLP_ENDPOINT", nil, func(c *conf) *string { return &c.tracingOTLPEndpoint }),
+	boolField("journal.enabled", "JOURNAL_ENABLED", func(c *conf) *bool { return &c.journalEnabled }),
+	stringField("journal.path", "JOURNAL_PATH", nil, func(c *conf) *string { return &c.journalPath }).asOptional(),
+	stringField("log.path", "LOG_PATH", nil, func(c *conf) *string { return &c.logPath }).asOptional(),
+	stringField("log.level", "LOG_LEVEL", isOneOf("debug", "info", "warn", "error"), func(c *conf) *string { return &c.logLevel }).asReloadable(),
+	stringField("log.console-format", "LOG_CONSOLE_FORMAT", isOneOf("console", "json"), func(c *conf) *string { return &c.logConsoleFormat }),
+	boolField("log.file-enabled", "LOG_FILE_ENABLED", func(c *conf) *bool { return &c.logFileEnabled }),
+	stringField("log.file-format", "LOG_FILE_FORMAT", isOneOf("console", "json"), func(c *conf) *string { return &c.logFileFormat }),
+	uintField("log.max-size-mb", "LOG_MAX_SIZE_MB", 1, unbounded, func(c *conf) *uint64 { return &c.logMaxSizeMB }),
+	uintField("log.max-age-days", "LOG_MAX_AGE_DAYS", 0, unbounded, func(c *conf) *uint64 { return &c.logMaxAgeDays }),
+	uintField("log.max-backups", "LOG_MAX_BACKUPS", 0, unbounded, func(c *conf) *uint64 { return &c.logMaxBackups }),
+	boolField("log.compress", "LOG_COMPRESS", func(c *conf) *bool { return &c.logCompress }),
+	uintField("log.sample-initial", "LOG_SAMPLE_INITIAL", 0, unbounded, func(c *conf) *uint64 { return &c.logSampleInitial }),
+	uintField("log.sample-thereafter", "LOG_SAMPLE_THEREAFTER", 1, unbounded, func(c *conf) *uint64 { return &c.logSampleThereafter }),
+}
+
+/* a rule across keys, checked once each of its keys is valid on its own */
+type dependency struct {
+	key   string
+	keys  []string
+	check func(c *conf) error
+}
+
+var dependencies = []dependency{
+	{
+		key:  "confirmation.seconds",
+		keys: []string{"confirmation.policy", "confirmation.seconds"},
+		check: func(c *conf) error {
+			if c.confirmationPolicy == "time" && c.confirmationSeconds == 0 {
+				return errors.New("must be greater than 0 with the time confirmation policy")
+			}
+			return nil
+		},
+	},
+	{
+		key:  "reconciliation.interval-seconds",
+		keys: []string{"reconciliation.enabled", "reconciliation.interval-seconds"},
+		check: func(c *conf) error {
+			if c.reconciliationEnabled && c.reconciliationInterval == 0 {
+				return errors.New("must be greater than 0 when reconciliation is enabled")
+			}
+			return nil
+		},
+	},
+	{
+		key:  "reconciliation.emit-corrections",
+		keys: []string{"reconciliation.enabled", "reconciliation.emit-corrections"},
+		check: func(c *conf) error {
+			if c.reconciliationCorrect && !c.reconciliationEnabled {
+				return errors.New("needs reconciliation.enabled, corrections are only emitted by reconciliation")
+			}
+			return nil
+		},
+	},
+	{
+		key:  "admin.token",
+		keys: []string{"admin.enabled", "admin.token"},
+		check: func(c *conf) error {
+			if len(c.adminToken) > 0 && !c.adminEnabled {
+				return errors.New("is set but admin.enabled is false, operation endpoints would not be served")
+			}
+			return nil
+		},
+	},
+	{
+		key:  "metadata.cache-size",
+		keys: []string{"metadata.enabled", "metadata.cache-size"},
+		check: func(c *conf) error {
+			if c.metadataEnabled && c.metadataCacheSize == 0 {
+				return errors.New("must be greater than 0 when metadata is enabled")
+			}
+			return nil
+		},
+	},
+	{
+		key:  "tracing.otlp-endpoint",
+		keys: []string{"tracing.exporter", "tracing.otlp-endpoint"},
+		check: func(c *conf) error {
+			if c.tracingExporter == "otlp" {
+				return isHostPort(c.tracingOTLPEndpoint)
+			}
+			return nil
+		},
+	},
+	directory("queue.path", "queue.durable", func(c *conf) (bool, string) { return c.queueDurable, c.queuePath }),
+	directory("checkpoint.path", "checkpoint.enabled", func(c *conf) (bool, string) { return c.checkpointEnabled, c.checkpointPath }),
+	directory("tracing.path", "tracing.exporter", func(c *conf) (bool, string) { return c.tracingExporter == "file", c.tracingPath }),
+	directory("journal.path", "journal.enabled", func(c *conf) (bool, string) { return c.journalEnabled, c.journalPath }),
+	directory("log.path", "log.file-enabled", func(c *conf) (bool, string) { return c.logFileEnabled, c.logPath }),
+}
+
+/* a directory only has to exist when the option writing to it is enabled */
+func directory(key string, enabledBy string, path func(c *conf) (bool, string)) dependency {
+	return dependency{
+		key:  key,
+		keys: []string{enabledBy, key},
+		check: func(c *conf) error {
+			if enabled, path := path(c); enabled && len(path) > 0 {
+				return isDirectory(path)
+			}
+			return nil
+		},
+	}
+}
+
+func stringField(key string, env string, check func(value string) error, target func(c *conf) *string) field {
+	return field{
+		key: key,
+		env: env,
+		parse: func(c *conf, value string) error {
+			if check != nil && len(value) > 0 {
+				if err := check(value); err != nil {
+					return err
+				}
+			}
+			*target(c) = value
+			return nil
+		},
+		format: func(c *conf) string { return *target(c) },
+	}
+}
+
+func uintField(key string, env string, min uint64, max uint64, target func(c *conf) *uint64) field {
+	return field{
+		key: key,
+		env: env,
+		parse: func(c *conf, value string) error {
+			parsed, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a non-negative integer", value)
+			}
+			if parsed < min {
+				return fmt.Errorf("%d must be at least %d", parsed, min)
+			}
+			if parsed > max {
+				return fmt.Errorf("%d must be at most %d", parsed, max)
+			}
+			*target(c) = parsed
+			return nil
+		},
+		format: func(c *conf) string { return strconv.FormatUint(*target(c), 10) },
+	}
+}
+
+func boolField(key string, env string, target func(c *conf) *bool) field {
+	return field{
+		key: key,
+		env: env,
+		parse: func(c *conf, value string) error {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%q is not true or false", value)
+			}
+			*target(c) = parsed
+			return nil
+		},
+		format: func(c *conf) string { return strconv.FormatBool(*target(c)) },
+	}
+}
+
+func (f field) asOptional() field {
+	f.optional = true
+	return f
+}
+
+func (f field) asSecret() field {
+	f.secret = true
+	return f
+}
+
+func (f field) asReloadable() field {
+	f.reloadable = true
+	return f
+}
+
+/* the value of a key and where it came from, a key missing everywhere comes from the base file */
+/* secrets can also be read from the file named by <env>_FILE, such as a mounted kubernetes secret */
+func (f field) lookup(layers []layer, overrides map[string]string) (string, string, error) {
+	if value, set := overrides[f.key]; set {
+		return value, "flag -" + f.key, nil
+	}
+	value, set := os.LookupEnv(f.env)
+	if f.secret {
+		if path, fileSet := os.LookupEnv(f.env + "_FILE"); fileSet {
+			source := "env " + f.env + "_FILE"
+			if set {
+				return "", source, fmt.Errorf("is set by both %s and %s_FILE", f.env, f.env)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", source, fmt.Errorf("could not read secret file: %v", err)
+			}
+			return strings.TrimSpace(string(content)), source, nil
+		}
+	}
+	if set {
+		return value, "env " + f.env, nil
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		if layers[i].config.Get(f.key) != nil {
+			return layers[i].config.GetString(f.key), layers[i].path, nil
+		}
+	}
+	return "", layers[0].path, nil
+}
+
+/* reads every key of the schema, then checks the rules across keys */
+func (c *conf) validate(layers []layer, overrides map[string]string) error {
+	errs := []FieldError{}
+	failed := map[string]bool{}
+	fail := func(key string, err error) {
+		failed[key] = true
+		errs = append(errs, FieldError{Key: key, Source: c.sources[key], Message: err.Error()})
+	}
+
+	for key := range overrides {
+		if _, known := fieldByKey(key); !known {
+			errs = append(errs, FieldError{Key: key, Source: "flag -" + key, Message: "is not a configuration key"})
+		}
+	}
+
+	for _, f := range schema {
+		value, source, err := f.lookup(layers, overrides)
+		c.sources[f.key] = source
+		if err != nil {
+			fail(f.key, err)
+			continue
+		}
+		if len(value) == 0 {
+			if !f.optional {
+				fail(f.key, errors.New("is required"))
+			}
+			continue
+		}
+		if err := f.parse(c, value); err != nil {
+			fail(f.key, err)
+		}
+	}
+
+	for _, d := range dependencies {
+		skip := false
+		for _, key := range d.keys {
+			skip = skip || failed[key]
+		}
+		if skip {
+			continue
+		}
+		if err := d.check(c); err != nil {
+			fail(d.key, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func fieldByKey(key string) (field, bool) {
+	for _, f := range schema {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+/* keys that can be set with a flag, in the order of the configuration file */
+/* secrets are left out, since flags show in the process list and shell history, they are set through <env> or <env>_FILE */
+func FlagKeys() []string {
+	keys := []string{}
+	for _, f := range schema {
+		if !f.secret {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
+
+/* checksummed addresses must match their checksum, all lower or upper case ones carry none */
+func isAddress(value string) error {
+	if !common.IsHexAddress(value) {
+		return fmt.Errorf("%q is not a hex address", value)
+	}
+	hex := strings.TrimPrefix(value, "0x")
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) && common.HexToAddress(value).Hex() != value {
+		return fmt.Errorf("%q has an invalid checksum, expected %s", value, common.HexToAddress(value).Hex())
+	}
+	return nil
+}
+
+/* urls are redacted in errors, since they might carry a key */
+func isURL(schemes ...string) func(value string) error {
+	return func(value string) error {
+		parsed, err := url.Parse(value)
+		if err != nil || len(parsed.Host) == 0 {
+			return fmt.Errorf("%q is not a url", redact(value))
+		}
+		for _, scheme := range schemes {
+			if parsed.Scheme == scheme {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q must use %s", redact(value), strings.Join(schemes, " or "))
+	}
+}
+
+/* the api port is configured apart and appended to the host */
+func isAPIHost(value string) error {
+	if err := isURL("http", "https")(value); err != nil {
+		return err
+	}
+	parsed, _ := url.Parse(value)
+	if len(parsed.Port()) > 0 {
+		return fmt.Errorf("%q must not include a port, it is set by star-notary-api.port", value)
+	}
+	if len(strings.Trim(parsed.Path, "/")) > 0 {
+		return fmt.Errorf("%q must not include a path", value)
+	}
+	return nil
+}
+
+func isPort(value string) error {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || port == 0 {
+		return fmt.Errorf("%q is not a port between 1 and 65535", value)
+	}
+	return nil
+}
+
+func isHostPort(value string) error {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil || len(host) == 0 {
+		return fmt.Errorf("%q is not a host and port", value)
+	}
+	return isPort(port)
+}
+
+func isDirectory(value string) error {
+	info, err := os.Stat(value)
+	if err != nil {
+		return fmt.Errorf("%q is not accessible: %v", value, errors.Unwrap(err))
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", value)
+	}
+	return nil
+}
+
+func isOneOf(values ...string) func(value string) error {
+	return func(value string) error {
+		for _, allowed := range values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q must be one of %s", value, strings.Join(values, ", "))
+	}
+}
+
+/* a key that failed validation and where its value came from */
+type FieldError struct {
+	Key     string
+	Source  string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s (from %s) %s", e.Key, e.Source, e.Message)
+}
+
+/* every error found in the configuration */
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = "  " + err.Error()
+	}
+	return fmt.Sprintf("%d invalid configuration keys:\n%s", len(e.Errors), strings.Join(lines, "\n"))
+}
+
+/* a configuration key with its effective value and where it came from */
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+/* effective value of every key, secrets redacted */
+func (c *conf) Settings() []Setting {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	settings := make([]Setting, len(schema))
+	for i, f := range schema {
+		value := f.format(c)
+		if f.secret && len(value) > 0 {
+			value = redact(value)
+		}
+		settings[i] = Setting{Key: f.key, Value: value, Source: c.sources[f.key]}
+	}
+	return settings
+}
+
+/* one key per line, for logs and the config check command */
+func Dump(settings []Setting) string {
+	lines := make([]string, len(settings))
+	for i, setting := range settings {
+		lines[i] = fmt.Sprintf("  %s = %q (from %s)", setting.Key, setting.Value, setting.Source)
+	}
+	return strings.Join(lines, "\n")
+}
+
+/* urls keep scheme and host, since the rest usually carries a key */
+func redact(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || len(parsed.Host) == 0 {
+		return redacted
+	}
+	return parsed.Scheme + "://" + parsed.Hostname() + "/" + redacted
+}
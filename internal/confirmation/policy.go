@@ -0,0 +1,140 @@
+package confirmation
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/eth"
+)
+
+const (
+	PolicyDepth     = "depth"
+	PolicySafe      = "safe"
+	PolicyFinalized = "finalized"
+	PolicyTime      = "time"
+)
+
+/* decides up to which block events are confirmed */
+type Policy interface {
+	Name() string
+	/* highest confirmed block number, from is the oldest block with pending events */
+	ConfirmedThrough(ctx context.Context, head *eth.Header, from *big.Int) (*big.Int, error)
+}
+
+/* a policy whose setting is stamped on each event when received, so a reloaded setting applies to new events only */
+type StampedPolicy interface {
+	Policy
+	Stamp(event *domain.GenericEvent)
+	/* highest confirmed block number given the pending events, in block order, and the current setting */
+	ConfirmedThroughEvents(head *eth.Header, events []domain.GenericEvent, confirmedThrough *big.Int) *big.Int
+}
+
+func NewPolicy(headers *eth.HeaderCache) Policy {
+	conf := conf.GetConf()
+	switch conf.ConfirmationPolicy() {
+	case PolicySafe:
+		return &tagPolicy{tag: PolicySafe}
+	case PolicyFinalized:
+		return &tagPolicy{tag: PolicyFinalized}
+	case PolicyTime:
+		return &timePolicy{headers: headers}
+	default:
+		return &depthPolicy{}
+	}
+}
+
+/* confirms events a number of blocks below head, at the depth they were received with since it can be reloaded */
+type depthPolicy struct{}
+
+func (p *depthPolicy) Name() string {
+	return PolicyDepth
+}
+
+/* depth of events received from now on, the range past every pending event included */
+func (p *depthPolicy) ConfirmedThrough(ctx context.Context, head *eth.Header, from *big.Int) (*big.Int, error) {
+	return new(big.Int).Sub(head.Number, new(big.Int).SetUint64(conf.GetConf().ConfirmationBlocks())), nil
+}
+
+func (p *depthPolicy) Stamp(event *domain.GenericEvent) {
+	depth := conf.GetConf().ConfirmationBlocks()
+	event.ConfirmationBlocks = &depth
+}
+
+/*
+pending events deep enough at their own depth raise the confirmed block, the first one that is not holds it below
+its block, since events are confirmed in block order, events without a depth are at the current one
+*/
+func (p *depthPolicy) ConfirmedThroughEvents(head *eth.Header, events []domain.GenericEvent, confirmedThrough *big.Int) *big.Int {
+	through := new(big.Int).Set(confirmedThrough)
+	for _, event := range events {
+		depth := conf.GetConf().ConfirmationBlocks()
+		if event.ConfirmationBlocks != nil {
+			depth = *event.ConfirmationBlocks
+		}
+		if new(big.Int).Add(event.BlockNumber, new(big.Int).SetUint64(depth)).Cmp(head.Number) == 1 {
+			if below := new(big.Int).Sub(event.BlockNumber, big.NewInt(1)); below.Cmp(through) == -1 {
+				through = below
+			}
+			return through
+		}
+		if event.BlockNumber.Cmp(through) == 1 {
+			through.Set(event.BlockNumber)
+		}
+	}
+	return through
+}
+
+/* confirms events up to the block the node reports under the "safe" or "finalized" tag */
+type tagPolicy struct {
+	tag string
+}
+
+func (p *tagPolicy) Name() string {
+	return p.tag
+}
+
+func (p *tagPolicy) ConfirmedThrough(ctx context.Context, head *eth.Header, from *big.Int) (*big.Int, error) {
+	tagged, err := eth.HeaderByTag(ctx, p.tag)
+	if err != nil {
+		return nil, err
+	}
+	return tagged.Number, nil
+}
+
+/* confirms events whose block is older than a number of seconds relative to head, read on every head since it can be reloaded */
+type timePolicy struct {
+	headers *eth.HeaderCache
+}
+
+func (p *timePolicy) Name() string {
+	return PolicyTime
+}
+
+/* binary searches the pending range for the newest block old enough, headers are cached between heads */
+func (p *timePolicy) ConfirmedThrough(ctx context.Context, head *eth.Header, from *big.Int) (*big.Int, error) {
+	seconds := conf.GetConf().ConfirmationSeconds()
+	if head.Time < seconds {
+		return new(big.Int).Sub(from, big.NewInt(1)), nil
+	}
+	deadline := head.Time - seconds
+
+	low := new(big.Int).Set(from)
+	high := new(big.Int).Set(head.Number)
+	through := new(big.Int).Sub(from, big.NewInt(1))
+	for low.Cmp(high) <= 0 {
+		middle := new(big.Int).Rsh(new(big.Int).Add(low, high), 1)
+		headers, err := p.headers.HeadersByNumber(ctx, []*big.Int{middle})
+		if err != nil {
+			return nil, err
+		}
+		if headers[middle.String()].Time <= deadline {
+			through.Set(middle)
+			low.Add(middle, big.NewInt(1))
+		} else {
+			high.Sub(middle, big.NewInt(1))
+		}
+	}
+	return through, nil
+}
@@ -0,0 +1,341 @@
+package delivery
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+/* events of one token, delivered strictly in (block, log index) order */
+type partition struct {
+	events   []domain.GenericEvent
+	attempts uint64
+	running  bool
+	failed   bool /* the head exhausted its attempts, the partition waits for it to be retried or dropped */
+}
+
+/* removes by id, since an earlier event might have been submitted while this one was in flight */
+func (p *partition) remove(event domain.GenericEvent) {
+	for i := range p.events {
+		if p.events[i].ID() == event.ID() && p.events[i].Status == event.Status {
+			p.events = append(p.events[:i], p.events[i+1:]...)
+			return
+		}
+	}
+}
+
+/* delivers confirmed events concurrently across tokens and sequentially within a token */
+type Scheduler struct {
+	lock       *sync.Mutex
+	wake       *sync.Cond
+	partitions map[string]*partition
+	ready      []string
+	deliver    func(context.Context, domain.GenericEvent) error
+	workers    int
+	running    *sync.WaitGroup
+	stopped    bool
+	paused     bool
+	ctx        context.Context /* passed to deliveries, cancelled when stop deadline is reached */
+	cancel     context.CancelFunc
+}
+
+func NewScheduler(deliver func(context.Context, domain.GenericEvent) error) *Scheduler {
+	conf := conf.GetConf()
+	lock := &sync.Mutex{}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		lock:       lock,
+		wake:       sync.NewCond(lock),
+		partitions: map[string]*partition{},
+		ready:      []string{},
+		deliver:    deliver,
+		workers:    int(conf.DeliveryWorkers()),
+		running:    &sync.WaitGroup{},
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func (s *Scheduler) Start() {
+	for i := 0; i < s.workers; i++ {
+		s.running.Add(1)
+		go s.work()
+	}
+}
+
+/* waits for submitted events to be delivered until ctx is done, then aborts in-flight deliveries and stops workers */
+/* returns the events left undelivered, failed ones and the ones held back by them included */
+/* a paused scheduler stops right away, as its events would not be delivered while waiting */
+func (s *Scheduler) Stop(ctx context.Context) []domain.GenericEvent {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for s.deliverable() > 0 && !s.Paused() && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	s.lock.Lock()
+	s.stopped = true
+	s.wake.Broadcast()
+	s.lock.Unlock()
+	s.cancel()
+	s.running.Wait()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	undelivered := []domain.GenericEvent{}
+	for _, p := range s.partitions {
+		undelivered = append(undelivered, p.events...)
+	}
+	return undelivered
+}
+
+func (s *Scheduler) Submit(events ...domain.GenericEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, event := range events {
+		p, exists := s.partitions[event.TokenId]
+		if !exists {
+			p = &partition{}
+			s.partitions[event.TokenId] = p
+		}
+		p.events = append(p.events, event)
+		sort.SliceStable(p.events, func(i, j int) bool {
+			return before(&p.events[i], &p.events[j])
+		})
+		if !p.running {
+			p.running = true
+			s.ready = append(s.ready, event.TokenId)
+		}
+	}
+
+	s.wake.Broadcast()
+}
+
+/* number of events waiting for delivery, including the ones in flight */
+func (s *Scheduler) Pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pending := 0
+	for _, p := range s.partitions {
+		pending += len(p.events)
+	}
+	return pending
+}
+
+/* events waiting for delivery outside of partitions held back by a failed event */
+func (s *Scheduler) deliverable() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	deliverable := 0
+	for _, p := range s.partitions {
+		if !p.failed {
+			deliverable += len(p.events)
+		}
+	}
+	return deliverable
+}
+
+/* oldest block with an event waiting for delivery or that exhausted its attempts, nil if there is none */
+func (s *Scheduler) OldestBlock() *big.Int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var oldest *big.Int
+	for _, p := range s.partitions {
+		if len(p.events) > 0 && (oldest == nil || p.events[0].BlockNumber.Cmp(oldest) == -1) {
+			oldest = p.events[0].BlockNumber
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+	return new(big.Int).Set(oldest)
+}
+
+/* holds deliveries back after the ones in flight, submitted events keep waiting */
+func (s *Scheduler) Pause() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.paused = true
+}
+
+func (s *Scheduler) Resume() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.paused = false
+	s.wake.Broadcast()
+}
+
+func (s *Scheduler) Paused() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.paused
+}
+
+/* delivers the events that exhausted their delivery attempts again, then the events they held back, returns how many */
+func (s *Scheduler) RetryFailed() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	retried := 0
+	for tokenId, p := range s.partitions {
+		if p.failed {
+			p.failed = false
+			p.attempts = 0
+			s.ready = append(s.ready, tokenId)
+			retried++
+		}
+	}
+	s.wake.Broadcast()
+	return retried
+}
+
+/* gives up on the events that exhausted their delivery attempts, releasing the events they held back */
+func (s *Scheduler) DropFailed() []domain.GenericEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	dropped := []domain.GenericEvent{}
+	for tokenId, p := range s.partitions {
+		if p.failed {
+			dropped = append(dropped, p.events[0])
+			p.events = p.events[1:]
+			p.failed = false
+			p.attempts = 0
+			s.ready = append(s.ready, tokenId)
+		}
+	}
+	s.wake.Broadcast()
+	return dropped
+}
+
+/* events that exhausted their delivery attempts */
+func (s *Scheduler) Failed() []domain.GenericEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	failed := []domain.GenericEvent{}
+	for _, p := range s.partitions {
+		if p.failed {
+			failed = append(failed, p.events[0])
+		}
+	}
+	return failed
+}
+
+func (s *Scheduler) work() {
+	defer s.running.Done()
+	for {
+		s.lock.Lock()
+		for (len(s.ready) == 0 || s.paused) && !s.stopped {
+			s.wake.Wait()
+		}
+		if s.stopped {
+			s.lock.Unlock()
+			return
+		}
+		tokenId := s.ready[0]
+		s.ready = s.ready[1:]
+		s.lock.Unlock()
+
+		s.drain(tokenId)
+	}
+}
+
+/* delivers a partition head first until it is empty or a delivery fails */
+func (s *Scheduler) drain(tokenId string) {
+	for {
+		s.lock.Lock()
+		p := s.partitions[tokenId]
+		if s.stopped {
+			p.running = false
+			s.lock.Unlock()
+			return
+		}
+		if s.paused {
+			/* picked up again on resume */
+			s.ready = append(s.ready, tokenId)
+			s.lock.Unlock()
+			return
+		}
+		if len(p.events) == 0 {
+			delete(s.partitions, tokenId)
+			s.lock.Unlock()
+			return
+		}
+		event := p.events[0]
+		s.lock.Unlock()
+
+		err := s.deliver(s.ctx, event)
+
+		s.lock.Lock()
+		if err != nil && s.ctx.Err() != nil {
+			/* delivery aborted by stop, the event is left undelivered */
+			s.lock.Unlock()
+			return
+		}
+		if err == nil {
+			p.remove(event)
+			p.attempts = 0
+			s.lock.Unlock()
+			continue
+		}
+
+		/* read on every failure, since retry settings can be reloaded */
+		conf := conf.GetConf()
+		p.attempts++
+		if conf.DeliveryMaxAttempts() > 0 && p.attempts >= conf.DeliveryMaxAttempts() {
+			/* later events of the token depend on this one, they wait until it is retried or dropped */
+			event.Logger().Error(
+				"giving up on event delivery, holding token events back until it is retried or dropped",
+				logger.String("message", err.Error()),
+				logger.Uint64("attempts", p.attempts),
+				logger.Int("held", len(p.events)-1),
+				logger.Object("event", &event),
+			)
+			p.failed = true
+			s.lock.Unlock()
+			return
+		}
+
+		/* hold the rest of the token events back until the failed one is delivered */
+		event.Logger().Warn(
+			"event delivery failed, holding token events back",
+			logger.String("message", err.Error()),
+			logger.Uint64("attempts", p.attempts),
+			logger.Int("held", len(p.events)-1),
+			logger.Object("event", &event),
+		)
+		s.lock.Unlock()
+		time.AfterFunc(time.Duration(conf.DeliveryRetrySeconds())*time.Second, func() {
+			s.lock.Lock()
+			s.ready = append(s.ready, tokenId)
+			s.wake.Signal()
+			s.lock.Unlock()
+		})
+		return
+	}
+}
+
+/* phases of the same event are delivered in this order */
+var phaseRank = map[string]int{
+	domain.StatusPending:   0,
+	domain.StatusConfirmed: 1,
+	domain.StatusRetracted: 2,
+}
+
+func before(a *domain.GenericEvent, b *domain.GenericEvent) bool {
+	if cmp := a.BlockNumber.Cmp(b.BlockNumber); cmp != 0 {
+		return cmp == -1
+	}
+	if a.LogIndex != b.LogIndex {
+		return a.LogIndex < b.LogIndex
+	}
+	return phaseRank[a.Status] < phaseRank[b.Status]
+}
@@ -3,13 +3,23 @@ package domain
 import (
 	"bytes"
 	"math/big"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/sergera/star-notary-listener/internal/logger"
 	"github.com/sergera/star-notary-listener/pkg/slc"
 )
 
+/* delivery phases, only sent when two phase delivery is enabled */
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusRetracted = "retracted"
+)
+
 type GenericEvent struct {
 	ContractHash string
 	EventType    string
@@ -22,33 +32,103 @@ type GenericEvent struct {
 	LogIndex     uint
 	Removed      bool
 	Date         string
+	ConfirmedBy  string
+	Status       string
+	/* confirmation depth when received, nil unless the depth policy is used */
+	ConfirmationBlocks *uint64
 	/* specific event fields */
 	Coordinates  string
 	Sender       string
+	PriceInWei   *big.Int
 	PriceInEther *big.Float
 	TokenId      string
 	Name         string
+	/* enrichment fields */
+	TokenURI    string
+	TotalSupply string
+	Metadata    *TokenMetadata
+	Transaction *TransactionDetails
+	/* sale attribution fields */
+	Seller   string
+	ListedAt string
+	/* tracing fields */
+	TraceParent string
 }
 
 func (e *GenericEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
 	enc.AddString("contractHash", e.ContractHash)
 	enc.AddString("eventType", e.EventType)
-	enc.AddString("data", string(e.Data))
+	enc.AddString("data", hexutil.Encode(e.Data))
+	enc.AddArray("topics", topics(e.Topics))
 	enc.AddString("blockNumber", e.BlockNumber.String())
 	enc.AddString("txHash", e.TxHash)
 	enc.AddUint("txIndex", e.TxIndex)
 	enc.AddString("blockHash", e.BlockHash)
 	enc.AddUint("logIndex", e.LogIndex)
 	enc.AddBool("removed", e.Removed)
+	enc.AddString("confirmedBy", e.ConfirmedBy)
+	enc.AddString("status", e.Status)
 	enc.AddString("coordinates", e.Coordinates)
 	enc.AddString("sender", e.Sender)
+	enc.AddString("priceInWei", e.PriceInWei.String())
 	enc.AddString("priceInEther", e.PriceInEther.String())
 	enc.AddString("tokenId", e.TokenId)
 	enc.AddString("name", e.Name)
 	enc.AddString("date", e.Date)
+	enc.AddString("tokenURI", e.TokenURI)
+	enc.AddString("totalSupply", e.TotalSupply)
+	if e.Metadata != nil {
+		enc.AddObject("metadata", e.Metadata)
+	}
+	if e.Transaction != nil {
+		enc.AddObject("transaction", e.Transaction)
+	}
+	enc.AddString("seller", e.Seller)
+	enc.AddString("listedAt", e.ListedAt)
+	return nil
+}
+
+type topics []common.Hash
+
+func (t topics) MarshalLogArray(enc logger.ArrayEncoder) error {
+	for _, topic := range t {
+		enc.AppendString(topic.Hex())
+	}
 	return nil
 }
 
+/* child logger identifying the event in every message logged while it is queued, confirmed and delivered */
+func (e *GenericEvent) Logger() *logger.Logger {
+	return logger.With(
+		logger.String("event_id", e.ID()),
+		logger.String("block", e.BlockNumber.String()),
+		logger.String("tx", e.TxHash),
+	)
+}
+
+/* a log is identified by the block that included it and its position in that block */
+func (e *GenericEvent) ID() string {
+	return e.BlockHash + ":" + strconv.FormatUint(uint64(e.LogIndex), 10)
+}
+
+/* events are only identified to the api when they are delivered in phases */
+func (g *GenericEvent) phaseEventId() string {
+	if len(g.Status) == 0 {
+		return ""
+	}
+	return g.ID()
+}
+
+func (g *GenericEvent) ToRetractEvent() RetractEvent {
+	return RetractEvent{
+		EventId:   g.ID(),
+		EventType: g.EventType,
+		TokenId:   g.TokenId,
+		Status:    StatusRetracted,
+		Date:      g.Date,
+	}
+}
+
 func (e *GenericEvent) IsDuplicate(duplicate *GenericEvent) bool {
 	if !slc.ShallowEqual(e.Topics, duplicate.Topics) ||
 		e.BlockNumber.String() != duplicate.BlockNumber.String() ||
@@ -75,14 +155,25 @@ func (g *GenericEvent) ToCreateEvent() CreateEvent {
 		TokenId:     g.TokenId,
 		Coordinates: g.Coordinates,
 		Date:        g.Date,
+		TokenURI:    g.TokenURI,
+		TotalSupply: g.TotalSupply,
+		Transaction: g.Transaction,
+		Status:      g.Status,
+		EventId:     g.phaseEventId(),
+		Metadata:    g.Metadata,
 	}
 }
 
 func (g *GenericEvent) ToChangeNameEvent() ChangeNameEvent {
 	return ChangeNameEvent{
-		NewName: g.Name,
-		TokenId: g.TokenId,
-		Date:    g.Date,
+		NewName:     g.Name,
+		TokenId:     g.TokenId,
+		Date:        g.Date,
+		TokenURI:    g.TokenURI,
+		TotalSupply: g.TotalSupply,
+		Transaction: g.Transaction,
+		Status:      g.Status,
+		EventId:     g.phaseEventId(),
 	}
 }
 
@@ -91,20 +182,66 @@ func (g *GenericEvent) ToPutForSaleEvent() PutForSaleEvent {
 		TokenId:      g.TokenId,
 		PriceInEther: strings.TrimRight(g.PriceInEther.Text('f', 18), ".0"),
 		Date:         g.Date,
+		TokenURI:     g.TokenURI,
+		TotalSupply:  g.TotalSupply,
+		Transaction:  g.Transaction,
+		Status:       g.Status,
+		EventId:      g.phaseEventId(),
 	}
 }
 
 func (g *GenericEvent) ToRemoveFromSaleEvent() RemoveFromSaleEvent {
 	return RemoveFromSaleEvent{
-		TokenId: g.TokenId,
-		Date:    g.Date,
+		TokenId:     g.TokenId,
+		Date:        g.Date,
+		TokenURI:    g.TokenURI,
+		TotalSupply: g.TotalSupply,
+		Transaction: g.Transaction,
+		Status:      g.Status,
+		EventId:     g.phaseEventId(),
 	}
 }
 
 func (g *GenericEvent) ToPurchaseEvent() PurchaseEvent {
-	return PurchaseEvent{
-		NewOwner: g.Sender,
-		TokenId:  g.TokenId,
-		Date:     g.Date,
+	purchase := PurchaseEvent{
+		NewOwner:    g.Sender,
+		TokenId:     g.TokenId,
+		Date:        g.Date,
+		TokenURI:    g.TokenURI,
+		TotalSupply: g.TotalSupply,
+		Transaction: g.Transaction,
+		Status:      g.Status,
+		EventId:     g.phaseEventId(),
+	}
+
+	if len(g.Seller) > 0 {
+		purchase.Seller = g.Seller
+		purchase.PriceInWei = g.PriceInWei.String()
+		purchase.PriceInEther = etherText(g.PriceInEther)
+		purchase.TimeOnMarketSeconds = secondsBetween(g.ListedAt, g.Date)
+	}
+
+	return purchase
+}
+
+func etherText(ether *big.Float) string {
+	text := ether.Text('f', 18)
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	return text
+}
+
+/* returns nil if either date is unknown */
+func secondsBetween(from string, to string) *int64 {
+	start, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return nil
+	}
+	end, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return nil
 	}
+	seconds := int64(end.Sub(start).Seconds())
+	return &seconds
 }
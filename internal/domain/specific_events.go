@@ -5,11 +5,17 @@ import (
 )
 
 type CreateEvent struct {
-	Owner       string `json:"owner"`
-	TokenId     string `json:"token_id"`
-	Coordinates string `json:"coordinates"`
-	Name        string `json:"name"`
-	Date        string `json:"date"`
+	Owner       string              `json:"owner"`
+	TokenId     string              `json:"token_id"`
+	Coordinates string              `json:"coordinates"`
+	Name        string              `json:"name"`
+	Date        string              `json:"date"`
+	TokenURI    string              `json:"token_uri,omitempty"`
+	TotalSupply string              `json:"total_supply,omitempty"`
+	Transaction *TransactionDetails `json:"transaction,omitempty"`
+	Status      string              `json:"status,omitempty"`
+	EventId     string              `json:"event_id,omitempty"`
+	Metadata    *TokenMetadata      `json:"metadata,omitempty"`
 }
 
 func (e *CreateEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
@@ -18,14 +24,29 @@ func (e *CreateEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
 	enc.AddString("Coordinates", e.Coordinates)
 	enc.AddString("Name", e.Name)
 	enc.AddString("Date", e.Date)
+	enc.AddString("TokenURI", e.TokenURI)
+	enc.AddString("TotalSupply", e.TotalSupply)
+	if e.Transaction != nil {
+		enc.AddObject("Transaction", e.Transaction)
+	}
+	enc.AddString("Status", e.Status)
+	enc.AddString("EventId", e.EventId)
+	if e.Metadata != nil {
+		enc.AddObject("Metadata", e.Metadata)
+	}
 	return nil
 }
 
 type ChangeNameEvent struct {
-	Owner   string `json:"owner"`
-	TokenId string `json:"token_id"`
-	NewName string `json:"name"`
-	Date    string `json:"date"`
+	Owner       string              `json:"owner"`
+	TokenId     string              `json:"token_id"`
+	NewName     string              `json:"name"`
+	Date        string              `json:"date"`
+	TokenURI    string              `json:"token_uri,omitempty"`
+	TotalSupply string              `json:"total_supply,omitempty"`
+	Transaction *TransactionDetails `json:"transaction,omitempty"`
+	Status      string              `json:"status,omitempty"`
+	EventId     string              `json:"event_id,omitempty"`
 }
 
 func (e *ChangeNameEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
@@ -33,14 +54,26 @@ func (e *ChangeNameEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
 	enc.AddString("TokenId", e.TokenId)
 	enc.AddString("NewName", e.NewName)
 	enc.AddString("Date", e.Date)
+	enc.AddString("TokenURI", e.TokenURI)
+	enc.AddString("TotalSupply", e.TotalSupply)
+	if e.Transaction != nil {
+		enc.AddObject("Transaction", e.Transaction)
+	}
+	enc.AddString("Status", e.Status)
+	enc.AddString("EventId", e.EventId)
 	return nil
 }
 
 type PutForSaleEvent struct {
-	Owner        string `json:"owner"`
-	TokenId      string `json:"token_id"`
-	PriceInEther string `json:"price"`
-	Date         string `json:"date"`
+	Owner        string              `json:"owner"`
+	TokenId      string              `json:"token_id"`
+	PriceInEther string              `json:"price"`
+	Date         string              `json:"date"`
+	TokenURI     string              `json:"token_uri,omitempty"`
+	TotalSupply  string              `json:"total_supply,omitempty"`
+	Transaction  *TransactionDetails `json:"transaction,omitempty"`
+	Status       string              `json:"status,omitempty"`
+	EventId      string              `json:"event_id,omitempty"`
 }
 
 func (e *PutForSaleEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
@@ -48,31 +81,89 @@ func (e *PutForSaleEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
 	enc.AddString("TokenId", e.TokenId)
 	enc.AddString("PriceInEther", e.PriceInEther)
 	enc.AddString("Date", e.Date)
+	enc.AddString("TokenURI", e.TokenURI)
+	enc.AddString("TotalSupply", e.TotalSupply)
+	if e.Transaction != nil {
+		enc.AddObject("Transaction", e.Transaction)
+	}
+	enc.AddString("Status", e.Status)
+	enc.AddString("EventId", e.EventId)
 	return nil
 }
 
 type RemoveFromSaleEvent struct {
-	Owner   string `json:"owner"`
-	TokenId string `json:"token_id"`
-	Date    string `json:"date"`
+	Owner       string              `json:"owner"`
+	TokenId     string              `json:"token_id"`
+	Date        string              `json:"date"`
+	TokenURI    string              `json:"token_uri,omitempty"`
+	TotalSupply string              `json:"total_supply,omitempty"`
+	Transaction *TransactionDetails `json:"transaction,omitempty"`
+	Status      string              `json:"status,omitempty"`
+	EventId     string              `json:"event_id,omitempty"`
 }
 
 func (e *RemoveFromSaleEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
 	enc.AddString("Owner", e.Owner)
 	enc.AddString("TokenId", e.TokenId)
 	enc.AddString("Date", e.Date)
+	enc.AddString("TokenURI", e.TokenURI)
+	enc.AddString("TotalSupply", e.TotalSupply)
+	if e.Transaction != nil {
+		enc.AddObject("Transaction", e.Transaction)
+	}
+	enc.AddString("Status", e.Status)
+	enc.AddString("EventId", e.EventId)
 	return nil
 }
 
 type PurchaseEvent struct {
-	NewOwner string `json:"owner"`
-	TokenId  string `json:"token_id"`
-	Date     string `json:"date"`
+	NewOwner            string              `json:"owner"`
+	TokenId             string              `json:"token_id"`
+	Date                string              `json:"date"`
+	TokenURI            string              `json:"token_uri,omitempty"`
+	TotalSupply         string              `json:"total_supply,omitempty"`
+	Transaction         *TransactionDetails `json:"transaction,omitempty"`
+	Status              string              `json:"status,omitempty"`
+	EventId             string              `json:"event_id,omitempty"`
+	Seller              string              `json:"seller,omitempty"`
+	PriceInWei          string              `json:"price_in_wei,omitempty"`
+	PriceInEther        string              `json:"price,omitempty"`
+	TimeOnMarketSeconds *int64              `json:"time_on_market_seconds,omitempty"`
 }
 
 func (e *PurchaseEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
 	enc.AddString("NewOwner", e.NewOwner)
 	enc.AddString("TokenId", e.TokenId)
 	enc.AddString("Date", e.Date)
+	enc.AddString("TokenURI", e.TokenURI)
+	enc.AddString("TotalSupply", e.TotalSupply)
+	if e.Transaction != nil {
+		enc.AddObject("Transaction", e.Transaction)
+	}
+	enc.AddString("Status", e.Status)
+	enc.AddString("EventId", e.EventId)
+	enc.AddString("Seller", e.Seller)
+	enc.AddString("PriceInWei", e.PriceInWei)
+	enc.AddString("PriceInEther", e.PriceInEther)
+	if e.TimeOnMarketSeconds != nil {
+		enc.AddInt64("TimeOnMarketSeconds", *e.TimeOnMarketSeconds)
+	}
+	return nil
+}
+
+type RetractEvent struct {
+	EventId   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	TokenId   string `json:"token_id"`
+	Status    string `json:"status"`
+	Date      string `json:"date"`
+}
+
+func (e *RetractEvent) MarshalLogObject(enc logger.ObjectEncoder) error {
+	enc.AddString("EventId", e.EventId)
+	enc.AddString("EventType", e.EventType)
+	enc.AddString("TokenId", e.TokenId)
+	enc.AddString("Status", e.Status)
+	enc.AddString("Date", e.Date)
 	return nil
 }
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+type TokenAttribute struct {
+	TraitType   string `json:"trait_type,omitempty"`
+	DisplayType string `json:"display_type,omitempty"`
+	Value       any    `json:"value"`
+}
+
+type TokenMetadata struct {
+	Name        string           `json:"name,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Image       string           `json:"image,omitempty"`
+	Attributes  []TokenAttribute `json:"attributes,omitempty"`
+}
+
+func (m *TokenMetadata) MarshalLogObject(enc logger.ObjectEncoder) error {
+	enc.AddString("Name", m.Name)
+	enc.AddString("Description", m.Description)
+	enc.AddString("Image", m.Image)
+	enc.AddArray("Attributes", tokenAttributes(m.Attributes))
+	return nil
+}
+
+type tokenAttributes []TokenAttribute
+
+func (a tokenAttributes) MarshalLogArray(enc logger.ArrayEncoder) error {
+	for _, attribute := range a {
+		enc.AppendString(attribute.TraitType + "=" + fmt.Sprint(attribute.Value))
+	}
+	return nil
+}
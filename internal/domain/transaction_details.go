@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+type TransactionDetails struct {
+	From                   string `json:"from"`
+	To                     string `json:"to"`
+	ValueInWei             string `json:"value_in_wei"`
+	GasUsed                uint64 `json:"gas_used"`
+	EffectiveGasPriceInWei string `json:"effective_gas_price_in_wei,omitempty"`
+	Status                 uint64 `json:"status"`
+}
+
+func (t *TransactionDetails) MarshalLogObject(enc logger.ObjectEncoder) error {
+	enc.AddString("From", t.From)
+	enc.AddString("To", t.To)
+	enc.AddString("ValueInWei", t.ValueInWei)
+	enc.AddUint64("GasUsed", t.GasUsed)
+	enc.AddString("EffectiveGasPriceInWei", t.EffectiveGasPriceInWei)
+	enc.AddUint64("Status", t.Status)
+	return nil
+}
@@ -0,0 +1,41 @@
+package enrichment
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+type Enricher struct {
+	caller *PinnedCaller
+}
+
+func NewEnricher(caller *PinnedCaller) *Enricher {
+	return &Enricher{
+		caller: caller,
+	}
+}
+
+func (e *Enricher) Enrich(ctx context.Context, event *domain.GenericEvent) {
+	tokenId, ok := new(big.Int).SetString(event.TokenId, 10)
+	if !ok {
+		logger.Error("could not parse token id for enrichment", logger.String("tokenId", event.TokenId))
+		return
+	}
+
+	tokenURI, err := e.caller.TokenURI(ctx, tokenId, event.BlockNumber)
+	if err != nil {
+		event.Logger().Error("could not get token uri", logger.String("message", err.Error()), logger.Object("event", event))
+	} else {
+		event.TokenURI = tokenURI
+	}
+
+	totalSupply, err := e.caller.TotalSupply(ctx, event.BlockNumber)
+	if err != nil {
+		event.Logger().Error("could not get total supply", logger.String("message", err.Error()), logger.Object("event", event))
+	} else {
+		event.TotalSupply = totalSupply.String()
+	}
+}
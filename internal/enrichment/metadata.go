@@ -0,0 +1,212 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/pkg/lru"
+)
+
+/* metadata documents larger than this are considered broken */
+const maxMetadataBytes = 1 << 20
+
+type MetadataEnricher struct {
+	caller        *PinnedCaller
+	client        *http.Client
+	ipfsGateway   string
+	cache         *lru.Cache[string, domain.TokenMetadata]
+	negativeCache *lru.Cache[string, time.Time]
+	negativeTTL   time.Duration
+}
+
+func NewMetadataEnricher(caller *PinnedCaller) *MetadataEnricher {
+	conf := conf.GetConf()
+	return &MetadataEnricher{
+		caller:        caller,
+		client:        &http.Client{Timeout: time.Duration(conf.MetadataTimeoutSeconds()) * time.Second},
+		ipfsGateway:   strings.TrimRight(conf.MetadataIPFSGateway(), "/") + "/",
+		cache:         lru.New[string, domain.TokenMetadata](int(conf.MetadataCacheSize())),
+		negativeCache: lru.New[string, time.Time](int(conf.MetadataCacheSize())),
+		negativeTTL:   time.Duration(conf.MetadataNegativeCacheSeconds()) * time.Second,
+	}
+}
+
+func (m *MetadataEnricher) Enrich(ctx context.Context, event *domain.GenericEvent) {
+	if event.EventType != "Create" {
+		return
+	}
+
+	tokenId, ok := new(big.Int).SetString(event.TokenId, 10)
+	if !ok {
+		logger.Error("could not parse token id for metadata enrichment", logger.String("tokenId", event.TokenId))
+		return
+	}
+
+	tokenURI, err := m.caller.TokenURI(ctx, tokenId, event.BlockNumber)
+	if err != nil {
+		event.Logger().Error("could not get token uri", logger.String("message", err.Error()), logger.Object("event", event))
+		return
+	}
+
+	metadata, err := m.Metadata(ctx, tokenURI)
+	if err != nil {
+		logger.Warn(
+			"could not get token metadata",
+			logger.String("message", err.Error()),
+			logger.String("tokenURI", tokenURI),
+			logger.String("tokenId", event.TokenId),
+		)
+		return
+	}
+
+	event.Metadata = &metadata
+}
+
+func (m *MetadataEnricher) Metadata(ctx context.Context, tokenURI string) (domain.TokenMetadata, error) {
+	if metadata, found := m.cache.Get(tokenURI); found {
+		return metadata, nil
+	}
+
+	if failedAt, found := m.negativeCache.Get(tokenURI); found {
+		if time.Since(failedAt) < m.negativeTTL {
+			return domain.TokenMetadata{}, errors.New("token uri recently failed, skipping")
+		}
+		m.negativeCache.Remove(tokenURI)
+	}
+
+	metadata, err := m.fetch(ctx, tokenURI)
+	if err != nil {
+		m.negativeCache.Add(tokenURI, time.Now())
+		return domain.TokenMetadata{}, err
+	}
+
+	m.cache.Add(tokenURI, metadata)
+	return metadata, nil
+}
+
+func (m *MetadataEnricher) fetch(ctx context.Context, tokenURI string) (domain.TokenMetadata, error) {
+	document, err := m.read(ctx, tokenURI)
+	if err != nil {
+		return domain.TokenMetadata{}, err
+	}
+
+	return parseMetadata(document)
+}
+
+func (m *MetadataEnricher) read(ctx context.Context, tokenURI string) ([]byte, error) {
+	if strings.HasPrefix(tokenURI, "data:") {
+		return readDataURI(tokenURI)
+	}
+
+	location, err := m.resolve(tokenURI)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := m.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching metadata: %s", response.Status)
+	}
+
+	document, err := io.ReadAll(io.LimitReader(response.Body, maxMetadataBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(document) > maxMetadataBytes {
+		return nil, errors.New("metadata document too large")
+	}
+
+	return document, nil
+}
+
+func (m *MetadataEnricher) resolve(tokenURI string) (string, error) {
+	parsed, err := url.Parse(tokenURI)
+	if err != nil {
+		return "", err
+	}
+
+	switch parsed.Scheme {
+	case "http", "https":
+		return tokenURI, nil
+	case "ipfs":
+		/* ipfs://<cid>/<path> and ipfs://ipfs/<cid>/<path> */
+		path := strings.TrimPrefix(strings.TrimPrefix(tokenURI, "ipfs://"), "ipfs/")
+		return m.ipfsGateway + path, nil
+	default:
+		return "", fmt.Errorf("unsupported token uri scheme: %q", parsed.Scheme)
+	}
+}
+
+func readDataURI(tokenURI string) ([]byte, error) {
+	header, payload, found := strings.Cut(strings.TrimPrefix(tokenURI, "data:"), ",")
+	if !found {
+		return nil, errors.New("malformed data uri")
+	}
+
+	if strings.HasSuffix(header, ";base64") {
+		return base64.StdEncoding.DecodeString(payload)
+	}
+
+	unescaped, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(unescaped), nil
+}
+
+/* validates the document against the ERC-721 metadata JSON schema */
+/* name, description and image must be strings, attributes follow the common trait convention */
+func parseMetadata(document []byte) (domain.TokenMetadata, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(document, &raw); err != nil {
+		return domain.TokenMetadata{}, fmt.Errorf("metadata is not a json object: %w", err)
+	}
+
+	metadata := domain.TokenMetadata{}
+	for key, target := range map[string]*string{
+		"name":        &metadata.Name,
+		"description": &metadata.Description,
+		"image":       &metadata.Image,
+	} {
+		value, exists := raw[key]
+		if !exists || string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return domain.TokenMetadata{}, fmt.Errorf("metadata %q must be a string", key)
+		}
+	}
+
+	if value, exists := raw["attributes"]; exists && string(value) != "null" {
+		if err := json.Unmarshal(value, &metadata.Attributes); err != nil {
+			return domain.TokenMetadata{}, errors.New("metadata \"attributes\" must be an array of objects")
+		}
+	}
+
+	if len(metadata.Name) == 0 && len(metadata.Image) == 0 {
+		return domain.TokenMetadata{}, errors.New("metadata has neither name nor image")
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,81 @@
+package enrichment
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+	"github.com/sergera/star-notary-listener/pkg/lru"
+)
+
+/* calls contract view functions at a given block, so results reflect the event's block and not latest */
+type PinnedCaller struct {
+	cache *lru.Cache[string, any]
+}
+
+func NewPinnedCaller(cacheSize int) *PinnedCaller {
+	return &PinnedCaller{
+		cache: lru.New[string, any](cacheSize),
+	}
+}
+
+func (p *PinnedCaller) call(ctx context.Context, method string, block *big.Int, args []string, fn func(opts *bind.CallOpts) (any, error)) (any, error) {
+	key := method + "(" + strings.Join(args, ",") + ")@" + block.String()
+	if value, found := p.cache.Get(key); found {
+		return value, nil
+	}
+
+	observe := metrics.ObserveRPC("eth_call")
+	value, err := fn(&bind.CallOpts{BlockNumber: block, Context: ctx})
+	observe(err)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cache.Add(key, value)
+	return value, nil
+}
+
+func (p *PinnedCaller) TokenURI(ctx context.Context, tokenId *big.Int, block *big.Int) (string, error) {
+	value, err := p.call(ctx, "tokenURI", block, []string{tokenId.String()}, func(opts *bind.CallOpts) (any, error) {
+		return eth.GetEth().Contract.TokenURI(opts, tokenId)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (p *PinnedCaller) TotalSupply(ctx context.Context, block *big.Int) (*big.Int, error) {
+	value, err := p.call(ctx, "totalSupply", block, nil, func(opts *bind.CallOpts) (any, error) {
+		return eth.GetEth().Contract.TotalSupply(opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*big.Int), nil
+}
+
+func (p *PinnedCaller) OwnerOf(ctx context.Context, tokenId *big.Int, block *big.Int) (string, error) {
+	value, err := p.call(ctx, "ownerOf", block, []string{tokenId.String()}, func(opts *bind.CallOpts) (any, error) {
+		owner, err := eth.GetEth().Contract.OwnerOf(opts, tokenId)
+		return owner.Hex(), err
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (p *PinnedCaller) TokenIdToSalePrice(ctx context.Context, tokenId *big.Int, block *big.Int) (*big.Int, error) {
+	value, err := p.call(ctx, "tokenIdToSalePrice", block, []string{tokenId.String()}, func(opts *bind.CallOpts) (any, error) {
+		return eth.GetEth().Contract.TokenIdToSalePrice(opts, tokenId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*big.Int), nil
+}
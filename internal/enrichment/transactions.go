@@ -0,0 +1,124 @@
+package enrichment
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+	"github.com/sergera/star-notary-listener/pkg/lru"
+)
+
+type rpcTransaction struct {
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+}
+
+type rpcReceipt struct {
+	GasUsed           hexutil.Uint64 `json:"gasUsed"`
+	EffectiveGasPrice *hexutil.Big   `json:"effectiveGasPrice"`
+	Status            hexutil.Uint64 `json:"status"`
+}
+
+type TransactionEnricher struct {
+	cache *lru.Cache[string, domain.TransactionDetails]
+}
+
+func NewTransactionEnricher(cacheSize int) *TransactionEnricher {
+	return &TransactionEnricher{
+		cache: lru.New[string, domain.TransactionDetails](cacheSize),
+	}
+}
+
+/* fetches transaction and receipt of every event, with one batched rpc request per block */
+func (t *TransactionEnricher) Enrich(ctx context.Context, events []domain.GenericEvent) {
+	byBlock := map[string][]int{}
+	blocks := []string{}
+	for i, event := range events {
+		block := event.BlockNumber.String()
+		if _, exists := byBlock[block]; !exists {
+			blocks = append(blocks, block)
+		}
+		byBlock[block] = append(byBlock[block], i)
+	}
+
+	for _, block := range blocks {
+		t.enrichBlock(ctx, events, byBlock[block])
+	}
+}
+
+func (t *TransactionEnricher) enrichBlock(ctx context.Context, events []domain.GenericEvent, indexes []int) {
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, i := range indexes {
+		txHash := events[i].TxHash
+		if _, found := t.cache.Get(txHash); found || seen[txHash] {
+			continue
+		}
+		seen[txHash] = true
+		missing = append(missing, txHash)
+	}
+
+	if len(missing) > 0 {
+		t.fetch(ctx, missing)
+	}
+
+	for _, i := range indexes {
+		if details, found := t.cache.Get(events[i].TxHash); found {
+			events[i].Transaction = &details
+		}
+	}
+}
+
+func (t *TransactionEnricher) fetch(ctx context.Context, txHashes []string) {
+	transactions := make([]*rpcTransaction, len(txHashes))
+	receipts := make([]*rpcReceipt, len(txHashes))
+	batch := make([]rpc.BatchElem, 0, 2*len(txHashes))
+	for i, txHash := range txHashes {
+		batch = append(batch,
+			rpc.BatchElem{Method: "eth_getTransactionByHash", Args: []interface{}{txHash}, Result: &transactions[i]},
+			rpc.BatchElem{Method: "eth_getTransactionReceipt", Args: []interface{}{txHash}, Result: &receipts[i]},
+		)
+	}
+
+	observe := metrics.ObserveRPC("eth_getTransactionByHash+eth_getTransactionReceipt")
+	err := eth.GetEth().RPC.BatchCallContext(ctx, batch)
+	observe(err)
+	if err != nil {
+		logger.Error("could not fetch transactions", logger.String("message", err.Error()))
+		return
+	}
+
+	for i, txHash := range txHashes {
+		if batch[2*i].Error != nil || batch[2*i+1].Error != nil || transactions[i] == nil || receipts[i] == nil {
+			logger.Error("could not fetch transaction", logger.String("txHash", txHash))
+			continue
+		}
+		t.cache.Add(txHash, toTransactionDetails(*transactions[i], *receipts[i]))
+	}
+}
+
+func toTransactionDetails(transaction rpcTransaction, receipt rpcReceipt) domain.TransactionDetails {
+	details := domain.TransactionDetails{
+		From:       transaction.From.Hex(),
+		ValueInWei: "0",
+		GasUsed:    uint64(receipt.GasUsed),
+		Status:     uint64(receipt.Status),
+	}
+	if transaction.To != nil {
+		details.To = transaction.To.Hex()
+	}
+	if transaction.Value != nil {
+		details.ValueInWei = (*big.Int)(transaction.Value).String()
+	}
+	if receipt.EffectiveGasPrice != nil {
+		details.EffectiveGasPriceInWei = (*big.Int)(receipt.EffectiveGasPrice).String()
+	}
+	return details
+}
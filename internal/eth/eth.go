@@ -11,18 +11,22 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/sergera/star-notary-listener/internal/conf"
 	"github.com/sergera/star-notary-listener/internal/gocontracts/starnotary"
 	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/metrics"
 )
 
 var once sync.Once
 var instance *eth
 
 type eth struct {
-	Client   *ethclient.Client
-	Contract *starnotary.Starnotary
-	ABI      *abi.ABI
+	RPC           *rpc.Client
+	Client        *ethclient.Client
+	Contract      *starnotary.Starnotary
+	ABI           *abi.ABI
+	stopKeepAlive context.CancelFunc
 }
 
 func GetEth() *eth {
@@ -38,26 +42,41 @@ func (e *eth) setup() {
 	e.setClient()
 	e.setContract()
 	e.setABI()
-	go e.avoidProviderTimeout()
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stopKeepAlive = cancel
+	go e.avoidProviderTimeout(ctx)
+}
+
+/* stops the keep alive and closes the connection, subscriptions must be unsubscribed before */
+func (e *eth) Close() {
+	e.stopKeepAlive()
+	e.RPC.Close()
 }
 
 func (e *eth) setClient() {
 	conf := conf.GetConf()
-	client, err := ethclient.Dial(conf.RPCProviderWebsocketURL())
+	rpcClient, err := rpc.Dial(conf.RPCProviderWebsocketURL())
 	if err != nil {
 		logger.Panic("could not dial eth client", logger.String("message", err.Error()))
 	}
 
-	e.Client = client
+	e.RPC = rpcClient
+	e.Client = ethclient.NewClient(rpcClient)
 }
 
-func (e *eth) avoidProviderTimeout() {
+func (e *eth) avoidProviderTimeout(ctx context.Context) {
 	for {
-		_, err := e.Client.BlockNumber(context.Background())
-		if err != nil {
+		observe := metrics.ObserveRPC("eth_blockNumber")
+		_, err := e.Client.BlockNumber(ctx)
+		observe(err)
+		if err != nil && ctx.Err() == nil {
 			logger.Error("disconnected: ", logger.String("message", err.Error()))
 		}
-		time.Sleep(30 * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
+		}
 	}
 }
 
@@ -73,12 +92,21 @@ func (e *eth) setContract() {
 }
 
 func (e *eth) setABI() {
-	starnotaryABI, err := abi.JSON(strings.NewReader(string(starnotary.StarnotaryMetaData.ABI)))
+	starnotaryABI, err := ParseABI()
 	if err != nil {
 		logger.Panic("could not read contract ABI", logger.String("message", err.Error()))
 	}
 
-	e.ABI = &starnotaryABI
+	e.ABI = starnotaryABI
+}
+
+/* parses the contract ABI, needs no connection to the RPC provider */
+func ParseABI() (*abi.ABI, error) {
+	starnotaryABI, err := abi.JSON(strings.NewReader(string(starnotary.StarnotaryMetaData.ABI)))
+	if err != nil {
+		return nil, err
+	}
+	return &starnotaryABI, nil
 }
 
 func WeiToEther(wei *big.Int) *big.Float {
@@ -0,0 +1,164 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+	"github.com/sergera/star-notary-listener/pkg/lru"
+)
+
+/*
+block header fields read by the listener, the hash is the one reported by the node, since go-ethereum
+headers of this version lack fields added by later forks and cannot rebuild the hash of newer blocks
+*/
+type Header struct {
+	Hash   string
+	Number *big.Int
+	Time   uint64
+}
+
+type rpcHeader struct {
+	Hash      *common.Hash   `json:"hash"`
+	Number    *hexutil.Big   `json:"number"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+}
+
+func (h *Header) UnmarshalJSON(input []byte) error {
+	var header rpcHeader
+	if err := json.Unmarshal(input, &header); err != nil {
+		return err
+	}
+	if header.Hash == nil || header.Number == nil {
+		return errors.New("header is missing its hash or number")
+	}
+	h.Hash = header.Hash.Hex()
+	h.Number = header.Number.ToInt()
+	h.Time = uint64(header.Timestamp)
+	return nil
+}
+
+/* header of a block, the latest if number is nil */
+func HeaderByNumber(ctx context.Context, number *big.Int) (*Header, error) {
+	if number == nil {
+		return HeaderByTag(ctx, "latest")
+	}
+	return HeaderByTag(ctx, hexutil.EncodeBig(number))
+}
+
+/* header of a block by number in hex or by tag, such as "safe" or "finalized" */
+func HeaderByTag(ctx context.Context, tag string) (*Header, error) {
+	var header *Header
+	observe := metrics.ObserveRPC("eth_getBlockByNumber")
+	err := GetEth().RPC.CallContext(ctx, &header, "eth_getBlockByNumber", tag, false)
+	observe(err)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %s not found", tag)
+	}
+	return header, nil
+}
+
+/* subscribes to the headers of new chain heads */
+func SubscribeNewHeads(ctx context.Context, heads chan<- *Header) (ethereum.Subscription, error) {
+	return GetEth().RPC.EthSubscribe(ctx, heads, "newHeads")
+}
+
+/* caches block headers by hash, with numbers pointing to the last hash seen at that height */
+type HeaderCache struct {
+	byHash   *lru.Cache[string, *Header]
+	byNumber *lru.Cache[string, string]
+}
+
+func NewHeaderCache(size int) *HeaderCache {
+	return &HeaderCache{
+		byHash:   lru.New[string, *Header](size),
+		byNumber: lru.New[string, string](size),
+	}
+}
+
+func (c *HeaderCache) Add(header *Header) {
+	c.byHash.Add(header.Hash, header)
+	c.byNumber.Add(header.Number.String(), header.Hash)
+}
+
+func (c *HeaderCache) ByNumber(number *big.Int) (*Header, bool) {
+	hash, found := c.byNumber.Get(number.String())
+	if !found {
+		return nil, false
+	}
+	return c.byHash.Get(hash)
+}
+
+func (c *HeaderCache) ByHash(hash string) (*Header, bool) {
+	return c.byHash.Get(hash)
+}
+
+/* drops the header at a height, used when a reorg replaced it */
+func (c *HeaderCache) Evict(number *big.Int) {
+	if hash, found := c.byNumber.Get(number.String()); found {
+		c.byHash.Remove(hash)
+	}
+	c.byNumber.Remove(number.String())
+}
+
+/* returns headers keyed by block number, requesting every uncached one in a single batch */
+func (c *HeaderCache) HeadersByNumber(ctx context.Context, numbers []*big.Int) (map[string]*Header, error) {
+	headers := map[string]*Header{}
+	missing := []*big.Int{}
+	for _, number := range numbers {
+		key := number.String()
+		if _, done := headers[key]; done {
+			continue
+		}
+		if header, found := c.ByNumber(number); found {
+			headers[key] = header
+			continue
+		}
+		headers[key] = nil
+		missing = append(missing, number)
+	}
+
+	if len(missing) == 0 {
+		return headers, nil
+	}
+
+	fetched := make([]*Header, len(missing))
+	batch := make([]rpc.BatchElem, len(missing))
+	for i, number := range missing {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []interface{}{hexutil.EncodeBig(number), false},
+			Result: &fetched[i],
+		}
+	}
+
+	observe := metrics.ObserveRPC("eth_getBlockByNumber")
+	err := GetEth().RPC.BatchCallContext(ctx, batch)
+	observe(err)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, number := range missing {
+		if batch[i].Error != nil {
+			return nil, batch[i].Error
+		}
+		if fetched[i] == nil {
+			return nil, fmt.Errorf("block %s not found", number.String())
+		}
+		c.Add(fetched[i])
+		headers[number.String()] = fetched[i]
+	}
+
+	return headers, nil
+}
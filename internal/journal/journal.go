@@ -0,0 +1,281 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+const journalFileName = "star-notary-listener-journal.ndjson"
+
+/* previous hash of the first entry */
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+/* entries are single lines, payloads included */
+const maxEntrySize = 16 * 1024 * 1024
+
+var once sync.Once
+var instance *Journal
+
+/* one request made to the star notary api, chained to the entry before it by its hash */
+type Entry struct {
+	Sequence     uint64          `json:"sequence"`
+	PreviousHash string          `json:"previous_hash"`
+	EventID      string          `json:"event_id,omitempty"`
+	Method       string          `json:"method"`
+	Route        string          `json:"route"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       int             `json:"status"`
+	Error        string          `json:"error,omitempty"`
+	SentAt       string          `json:"sent_at"`
+	RespondedAt  string          `json:"responded_at"`
+	Hash         string          `json:"hash,omitempty"`
+}
+
+/* sha256 of the entry encoded without its hash */
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+/*
+append-only journal of deliveries, each entry carrying the hash of the one before it, every process delivering
+events writes to the same chain, taking an exclusive lock on the file and reading the last entry before each write
+*/
+type Journal struct {
+	lock *sync.Mutex
+	path string
+	file *os.File
+}
+
+/* the journal of the process, nil if disabled, so deliveries of every component share one chain */
+func GetJournal() *Journal {
+	once.Do(func() {
+		if conf.GetConf().JournalEnabled() {
+			instance = open(Path())
+		}
+	})
+	return instance
+}
+
+/* path of the journal file in the configured directory */
+func Path() string {
+	return filepath.Join(conf.GetConf().JournalPath(), journalFileName)
+}
+
+/* fails if the last entry cannot be read, since the chain could not be continued */
+func open(path string) *Journal {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		logger.Panic("could not open journal", logger.String("message", err.Error()))
+	}
+	j := &Journal{lock: &sync.Mutex{}, path: path, file: file}
+
+	if err := lockFile(file); err != nil {
+		logger.Panic("could not lock journal", logger.String("message", err.Error()))
+	}
+	last, err := j.last()
+	unlockFile(file)
+	if err != nil {
+		logger.Panic("could not continue journal", logger.String("message", err.Error()))
+	}
+
+	logger.Info("opened journal", logger.String("path", path), logger.Uint64("entries", last.Sequence))
+	return j
+}
+
+/* chains the entry to the last one and writes it, synced to disk before returning */
+func (j *Journal) Record(entry Entry) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if err := lockFile(j.file); err != nil {
+		return err
+	}
+	defer unlockFile(j.file)
+
+	last, err := j.last()
+	if err != nil {
+		return err
+	}
+	entry.Sequence = last.Sequence + 1
+	entry.PreviousHash = last.Hash
+	hash, err := entry.hash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+/*
+last complete entry of the file, with the genesis hash if there is none, called with the file locked
+a line left without newline by a crash during a write is truncated, as it was never part of the chain
+*/
+func (j *Journal) last() (Entry, error) {
+	info, err := j.file.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	end, err := lastNewline(j.file, info.Size())
+	if err != nil {
+		return Entry{}, err
+	}
+	if end+1 < info.Size() {
+		logger.Warn("truncating incomplete journal entry", logger.String("path", j.path), logger.Int64("bytes", info.Size()-end-1))
+		if err := j.file.Truncate(end + 1); err != nil {
+			return Entry{}, err
+		}
+		if err := j.file.Sync(); err != nil {
+			return Entry{}, err
+		}
+	}
+	if end < 0 {
+		return Entry{Hash: genesisHash}, nil
+	}
+
+	start, err := lastNewline(j.file, end)
+	if err != nil {
+		return Entry{}, err
+	}
+	line := make([]byte, end-start-1)
+	if _, err := j.file.ReadAt(line, start+1); err != nil {
+		return Entry{}, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return Entry{}, fmt.Errorf("last journal entry is unreadable, run verify-journal: %w", err)
+	}
+	return entry, nil
+}
+
+/* offset of the last newline before the given offset, -1 if there is none */
+func lastNewline(file *os.File, before int64) (int64, error) {
+	chunk := make([]byte, 64*1024)
+	for end := before; end > 0; {
+		start := end - int64(len(chunk))
+		if start < 0 {
+			start = 0
+		}
+		if _, err := file.ReadAt(chunk[:end-start], start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk[:end-start], '\n'); i >= 0 {
+			return start + int64(i), nil
+		}
+		end = start
+	}
+	return -1, nil
+}
+
+/* entries, problems and last hash of a journal file */
+type Verification struct {
+	Entries  uint64
+	LastHash string
+	Problems []string
+}
+
+/* every problem found in the journal */
+type VerificationError struct {
+	Problems []string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%d journal problems:\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+/*
+checks that sequences follow each other without gaps, that each entry carries the hash of the one before it
+and that each hash matches the content of its entry, entries removed from the end can only be detected
+by comparing the last hash with one recorded before
+*/
+func Verify(path string) (Verification, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Verification{}, err
+	}
+	defer file.Close()
+
+	v := Verification{LastHash: genesisHash}
+	previous := Entry{Hash: genesisHash}
+	scanner := newScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			v.Problems = append(v.Problems, fmt.Sprintf("line %d is not a journal entry: %s", line, err.Error()))
+			continue
+		}
+		v.Entries++
+
+		if entry.Sequence != previous.Sequence+1 {
+			v.Problems = append(v.Problems, fmt.Sprintf("line %d has sequence %d, expected %d", line, entry.Sequence, previous.Sequence+1))
+		}
+		if entry.PreviousHash != previous.Hash {
+			v.Problems = append(v.Problems, fmt.Sprintf("line %d does not chain to the entry before it", line))
+		}
+		if hash, err := entry.hash(); err != nil || hash != entry.Hash {
+			v.Problems = append(v.Problems, fmt.Sprintf("line %d does not match its hash, it was modified", line))
+		}
+
+		previous = entry
+		v.LastHash = entry.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return v, err
+	}
+
+	if len(v.Problems) > 0 {
+		return v, &VerificationError{v.Problems}
+	}
+	return v, nil
+}
+
+func newScanner(file *os.File) *bufio.Scanner {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+	return scanner
+}
+
+type eventIDKey struct{}
+
+/* returns a context carrying the id of the event being delivered, for the journal entry of its request */
+func WithEventID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, eventIDKey{}, id)
+}
+
+func EventID(ctx context.Context) string {
+	id, _ := ctx.Value(eventIDKey{}).(string)
+	return id
+}
+
+/* formats entry timestamps */
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
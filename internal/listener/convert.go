@@ -19,6 +19,7 @@ func createToGeneric(subscribedEvent starnotary.StarnotaryCreate) domain.Generic
 		TokenId:      subscribedEvent.TokenId.Text(10),
 		Coordinates:  string(subscribedEvent.Coordinates[:]),
 		Name:         string(subscribedEvent.Name),
+		PriceInWei:   big.NewInt(0),
 		PriceInEther: big.NewFloat(0),
 		EventType:    eventSignatureToType[subscribedEvent.Raw.Topics[0].Hex()],
 
@@ -40,6 +41,7 @@ func changeNameToGeneric(subscribedEvent starnotary.StarnotaryChangeName) domain
 		Sender:       common.Address.Hex(subscribedEvent.Owner),
 		Name:         string(subscribedEvent.NewName),
 		TokenId:      subscribedEvent.TokenId.Text(10),
+		PriceInWei:   big.NewInt(0),
 		PriceInEther: big.NewFloat(0),
 		EventType:    eventSignatureToType[subscribedEvent.Raw.Topics[0].Hex()],
 
@@ -60,6 +62,7 @@ func putForSaleToGeneric(subscribedEvent starnotary.StarnotaryPutForSale) domain
 	return domain.GenericEvent{
 		Sender:       common.Address.Hex(subscribedEvent.Owner),
 		TokenId:      subscribedEvent.TokenId.Text(10),
+		PriceInWei:   subscribedEvent.PriceInWei,
 		PriceInEther: eth.WeiToEther(subscribedEvent.PriceInWei),
 		EventType:    eventSignatureToType[subscribedEvent.Raw.Topics[0].Hex()],
 
@@ -80,6 +83,7 @@ func removeFromSaleToGeneric(subscribedEvent starnotary.StarnotaryRemoveFromSale
 	return domain.GenericEvent{
 		Sender:       common.Address.Hex(subscribedEvent.Owner),
 		TokenId:      subscribedEvent.TokenId.Text(10),
+		PriceInWei:   big.NewInt(0),
 		PriceInEther: big.NewFloat(0),
 		EventType:    eventSignatureToType[subscribedEvent.Raw.Topics[0].Hex()],
 
@@ -100,6 +104,7 @@ func purchaseToGeneric(subscribedEvent starnotary.StarnotaryPurchase) domain.Gen
 	return domain.GenericEvent{
 		Sender:       common.Address.Hex(subscribedEvent.NewOwner),
 		TokenId:      subscribedEvent.TokenId.Text(10),
+		PriceInWei:   big.NewInt(0),
 		PriceInEther: big.NewFloat(0),
 		EventType:    eventSignatureToType[subscribedEvent.Raw.Topics[0].Hex()],
 
@@ -2,20 +2,33 @@ package listener
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/sergera/star-notary-listener/internal/checkpoint"
 	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/confirmation"
+	"github.com/sergera/star-notary-listener/internal/delivery"
 	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/enrichment"
 	"github.com/sergera/star-notary-listener/internal/eth"
 	"github.com/sergera/star-notary-listener/internal/gocontracts/starnotary"
+	"github.com/sergera/star-notary-listener/internal/journal"
 	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+	"github.com/sergera/star-notary-listener/internal/projection"
 	"github.com/sergera/star-notary-listener/internal/queue"
+	"github.com/sergera/star-notary-listener/internal/sales"
 	"github.com/sergera/star-notary-listener/internal/service"
+	"github.com/sergera/star-notary-listener/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var eventSignatureToType = map[string]string{
@@ -27,25 +40,162 @@ var eventSignatureToType = map[string]string{
 }
 
 type Listener struct {
-	queue           *queue.EventQueue
+	queue           queue.Queue
+	projection      *projection.Projection
+	enricher        *enrichment.Enricher
+	metadata        *enrichment.MetadataEnricher
+	transactions    *enrichment.TransactionEnricher
+	headers         *eth.HeaderCache
+	scheduler       *delivery.Scheduler
+	sales           *sales.Tracker
 	api             *service.StarNotaryAPIService
 	contractAddress string
-	confirmDelay    uint64
-	confirmBlocks   uint64
+	policy          confirmation.Policy
+	twoPhase        bool
+	shutdownTimeout time.Duration
+	tracker         *tracker
+	checkpoint      *checkpoint.Checkpoint
+	catchUp         *catchUp
 }
 
 func NewListener() *Listener {
+	l := newListener(queue.NewQueue())
+	if conf.GetConf().CheckpointEnabled() {
+		l.checkpoint = checkpoint.NewCheckpoint()
+	}
+	return l
+}
+
+/*
+listener that only delivers past events, alongside a listener that may be running, so it must not open
+the write-ahead log or the checkpoint of that listener
+*/
+func NewBackfillListener() *Listener {
+	return newListener(queue.NewPendingStore())
+}
+
+func newListener(queue queue.Queue) *Listener {
 	conf := conf.GetConf()
-	return &Listener{
-		queue:           queue.NewEventQueue(),
+	caller := enrichment.NewPinnedCaller(int(conf.EnrichmentCacheSize()))
+	var enricher *enrichment.Enricher
+	if conf.EnrichmentEnabled() {
+		enricher = enrichment.NewEnricher(caller)
+	}
+	var metadata *enrichment.MetadataEnricher
+	if conf.MetadataEnabled() {
+		metadata = enrichment.NewMetadataEnricher(caller)
+	}
+	var transactions *enrichment.TransactionEnricher
+	if conf.TransactionsEnabled() {
+		transactions = enrichment.NewTransactionEnricher(int(conf.EnrichmentCacheSize()))
+	}
+	l := &Listener{
+		queue:           queue,
+		projection:      projection.NewProjection(),
+		enricher:        enricher,
+		metadata:        metadata,
+		transactions:    transactions,
+		headers:         eth.NewHeaderCache(int(conf.RPCProviderHeaderCacheSize())),
+		sales:           sales.NewTracker(caller),
 		api:             service.NewStarNotaryAPIService(),
 		contractAddress: conf.ContractAddress(),
-		confirmDelay:    conf.ConfirmationSleepSeconds(),
-		confirmBlocks:   conf.ConfirmationBlocks(),
+		twoPhase:        conf.DeliveryTwoPhase(),
+		shutdownTimeout: time.Duration(conf.ShutdownTimeoutSeconds()) * time.Second,
+		tracker:         newTracker(),
+		catchUp:         newCatchUp(),
+	}
+	l.policy = confirmation.NewPolicy(l.headers)
+	l.scheduler = delivery.NewScheduler(l.deliver)
+	return l
+}
+
+func (l *Listener) Projection() *projection.Projection {
+	return l.projection
+}
+
+/* listens until ctx is done, then stops intake and confirmation and drains deliveries */
+func (l *Listener) Listen(ctx context.Context) {
+	if durable, ok := l.queue.(*queue.DurableStore); ok {
+		l.verifyRecovered(ctx, durable.Recovered())
+	}
+	l.scheduler.Start()
+
+	confirming := &sync.WaitGroup{}
+	confirming.Add(1)
+	go func() {
+		defer confirming.Done()
+		l.confirm(ctx)
+	}()
+	l.intake(ctx)
+	confirming.Wait()
+
+	l.shutdown()
+}
+
+/* gives confirmed events the shutdown timeout to be delivered, keeping the ones left in the log if durable */
+func (l *Listener) shutdown() {
+	logger.Info("shutting down, delivering confirmed events", logger.Int("pending", l.scheduler.Pending()))
+	ctx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
+	defer cancel()
+
+	/* confirmed events stay in a durable queue until delivered, so undelivered ones are confirmed again on start */
+	undelivered := l.scheduler.Stop(ctx)
+	durable, isDurable := l.queue.(*queue.DurableStore)
+	for _, event := range undelivered {
+		event.Logger().Warn("event left undelivered on shutdown", logger.Object("event", &event))
+	}
+
+	if l.tracker.confirmed() {
+		l.saveCheckpoint(l.tracker.lastConfirmedBlock())
+	}
+	if isDurable {
+		if err := durable.Close(); err != nil {
+			logger.Error("could not close pending events log", logger.String("message", err.Error()))
+		}
+	}
+	logger.Info("listener stopped", logger.Int("undelivered", len(undelivered)))
+}
+
+/* drops recovered events whose logs are no longer in the block that included them */
+func (l *Listener) verifyRecovered(ctx context.Context, events []domain.GenericEvent) {
+	eth := eth.GetEth()
+	logsByBlock := map[string]map[string]bool{}
+
+	for _, event := range events {
+		onChain, fetched := logsByBlock[event.BlockHash]
+		if !fetched {
+			blockHash := common.HexToHash(event.BlockHash)
+			observe := metrics.ObserveRPC("eth_getLogs")
+			logs, err := eth.Client.FilterLogs(ctx, ethereum.FilterQuery{
+				BlockHash: &blockHash,
+				Addresses: []common.Address{common.HexToAddress(l.contractAddress)},
+			})
+			observe(err)
+			if err != nil {
+				/* block might have been replaced, leave it to confirmation to drop it as leftover */
+				event.Logger().Warn("could not verify recovered event", logger.String("message", err.Error()), logger.Object("event", &event))
+				continue
+			}
+			onChain = map[string]bool{}
+			for _, log := range logs {
+				if !log.Removed {
+					onChain[log.TxHash.Hex()+":"+strconv.FormatUint(uint64(log.Index), 10)] = true
+				}
+			}
+			logsByBlock[event.BlockHash] = onChain
+		}
+
+		if !onChain[event.TxHash+":"+strconv.FormatUint(uint64(event.LogIndex), 10)] {
+			event.Logger().Warn("dropping recovered event no longer on chain", logger.Object("event", &event))
+			if l.queue.Remove(event) {
+				metrics.EventsReorged.WithLabelValues(event.EventType).Inc()
+				l.retract(event)
+			}
+		}
 	}
 }
 
-func (l *Listener) Listen() {
+func (l *Listener) intake(ctx context.Context) {
 	eth := eth.GetEth()
 
 	createResChan := make(chan *starnotary.StarnotaryCreate)
@@ -60,65 +210,243 @@ func (l *Listener) Listen() {
 	defer close(removeFromSaleResChan)
 	defer close(purchaseResChan)
 
-	eth.Contract.WatchCreate(&bind.WatchOpts{Start: nil, Context: context.Background()}, createResChan)
-	eth.Contract.WatchChangeName(&bind.WatchOpts{Start: nil, Context: context.Background()}, changeNameResChan)
-	eth.Contract.WatchPutForSale(&bind.WatchOpts{Start: nil, Context: context.Background()}, putForSaleResChan)
-	eth.Contract.WatchRemoveFromSale(&bind.WatchOpts{Start: nil, Context: context.Background()}, removeFromSaleResChan)
-	eth.Contract.WatchPurchase(&bind.WatchOpts{Start: nil, Context: context.Background()}, purchaseResChan)
+	watchOpts := &bind.WatchOpts{Start: nil, Context: ctx}
+	subscriptions := []event.Subscription{}
+	watch := func(name string) func(event.Subscription, error) {
+		return func(subscription event.Subscription, err error) {
+			if err != nil {
+				logger.Panic("could not watch contract events", logger.String("subscription", name), logger.String("message", err.Error()))
+			}
+			subscriptions = append(subscriptions, subscription)
+			go l.tracker.monitor(name, subscription)
+		}
+	}
+	watch(subscriptionCreate)(eth.Contract.WatchCreate(watchOpts, createResChan))
+	watch(subscriptionChangeName)(eth.Contract.WatchChangeName(watchOpts, changeNameResChan))
+	watch(subscriptionPutForSale)(eth.Contract.WatchPutForSale(watchOpts, putForSaleResChan))
+	watch(subscriptionRemoveFromSale)(eth.Contract.WatchRemoveFromSale(watchOpts, removeFromSaleResChan))
+	watch(subscriptionPurchase)(eth.Contract.WatchPurchase(watchOpts, purchaseResChan))
+	/* unsubscribe before channels are closed, so watchers stop sending */
+	defer func() {
+		for _, subscription := range subscriptions {
+			subscription.Unsubscribe()
+		}
+	}()
+
+	/* subscriptions are up, so nothing emitted since the checkpoint is missed */
+	/* received alongside the subscriptions, so they are drained however far behind the checkpoint is */
+	backfilling := &sync.WaitGroup{}
+	defer backfilling.Wait()
+	if l.checkpoint != nil {
+		if block, found := l.checkpoint.Block(); found {
+			from := new(big.Int).Add(block, big.NewInt(1))
+			l.catchUp.start(from)
+			backfilling.Add(1)
+			go func() {
+				defer backfilling.Done()
+				if err := l.backfill(ctx, from); err != nil && ctx.Err() == nil {
+					logger.Error(
+						"could not receive events emitted since checkpoint, holding the checkpoint until the listener restarts or it is set again",
+						logger.String("message", err.Error()),
+						logger.String("checkpoint", l.catchUp.held().String()),
+					)
+				}
+			}()
+		}
+	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			logger.Info("stopped listening to contract events")
+			return
 		case createEvent := <-createResChan:
 			genericCreate := createToGeneric(*createEvent)
-			l.queue.InsertEventByBlockNumber(genericCreate)
-			logger.Info("create event to list", logger.Object("event", &genericCreate))
+			l.receive(ctx, genericCreate)
+			genericCreate.Logger().Info("create event to list", logger.Object("event", &genericCreate))
 		case changeNameEvent := <-changeNameResChan:
 			genericChangeName := changeNameToGeneric(*changeNameEvent)
-			l.queue.InsertEventByBlockNumber(genericChangeName)
-			logger.Info("changed name event to list", logger.Object("event", &genericChangeName))
+			l.receive(ctx, genericChangeName)
+			genericChangeName.Logger().Info("changed name event to list", logger.Object("event", &genericChangeName))
 		case putForSaleEvent := <-putForSaleResChan:
 			genericPutForSale := putForSaleToGeneric(*putForSaleEvent)
-			l.queue.InsertEventByBlockNumber(genericPutForSale)
-			logger.Info("put for sale event to list", logger.Object("event", &genericPutForSale))
+			l.receive(ctx, genericPutForSale)
+			genericPutForSale.Logger().Info("put for sale event to list", logger.Object("event", &genericPutForSale))
 		case removeFromSaleEvent := <-removeFromSaleResChan:
 			genericRemoveFromSale := removeFromSaleToGeneric(*removeFromSaleEvent)
-			l.queue.InsertEventByBlockNumber(genericRemoveFromSale)
-			logger.Info("removed from sale event to list", logger.Object("event", &genericRemoveFromSale))
+			l.receive(ctx, genericRemoveFromSale)
+			genericRemoveFromSale.Logger().Info("removed from sale event to list", logger.Object("event", &genericRemoveFromSale))
 		case purchaseEvent := <-purchaseResChan:
 			genericPurchase := purchaseToGeneric(*purchaseEvent)
-			l.queue.InsertEventByBlockNumber(genericPurchase)
-			logger.Info("purchase event to list", logger.Object("event", &genericPurchase))
-		default:
+			l.receive(ctx, genericPurchase)
+			genericPurchase.Logger().Info("purchase event to list", logger.Object("event", &genericPurchase))
+		}
+	}
+}
+
+func (l *Listener) receive(ctx context.Context, event domain.GenericEvent) {
+	metrics.EventsReceived.WithLabelValues(event.EventType).Inc()
+	defer metrics.QueueDepth.Set(float64(l.queue.Length()))
+
+	/* root of the event trace, later steps join it through the traceparent kept on the event */
+	traceCtx, span := tracing.Start(context.Background(), "event.receive", tracing.EventAttributes(&event), trace.WithAttributes(
+		tracing.Removed.Bool(event.Removed),
+	))
+	defer span.End()
+	event.TraceParent = tracing.TraceParent(traceCtx)
+
+	if event.Removed {
+		/* log was reorged out, forget it and take back what was announced */
+		if l.queue.Remove(event) {
+			metrics.EventsReorged.WithLabelValues(event.EventType).Inc()
+			l.retract(event)
+		}
+		return
+	}
+
+	if stamped, ok := l.policy.(confirmation.StampedPolicy); ok {
+		stamped.Stamp(&event)
+	}
+	_, queueSpan := tracing.Start(traceCtx, "event.queue", tracing.EventAttributes(&event))
+	inserted := l.queue.Insert(ctx, event)
+	queueSpan.SetAttributes(tracing.Inserted.Bool(inserted))
+	queueSpan.End()
+	if inserted && l.twoPhase {
+		l.announce(ctx, event)
+	}
+}
+
+/* delivers an unconfirmed event as pending, to be followed by its confirmation or retraction */
+func (l *Listener) announce(ctx context.Context, event domain.GenericEvent) {
+	headers, err := l.headers.HeadersByNumber(ctx, []*big.Int{event.BlockNumber})
+	if err == nil && headers[event.BlockNumber.String()].Hash == event.BlockHash {
+		event.Date = time.Unix(int64(headers[event.BlockNumber.String()].Time), 0).Format(time.RFC3339)
+	}
+	event.Status = domain.StatusPending
+	l.scheduler.Submit(event)
+}
+
+func (l *Listener) retract(event domain.GenericEvent) {
+	if !l.twoPhase {
+		return
+	}
+	event.Status = domain.StatusRetracted
+	l.scheduler.Submit(event)
+}
+
+func (l *Listener) confirm(ctx context.Context) {
+	for ctx.Err() == nil {
+		headsChan := make(chan *eth.Header, 16)
+		subscription, err := eth.SubscribeNewHeads(ctx, headsChan)
+		if err == nil {
+			l.confirmOnNewHeads(ctx, headsChan, subscription)
+		} else if ctx.Err() == nil {
+			logger.Error("could not subscribe to new heads", logger.String("message", err.Error()))
+			l.tracker.setSubscription(subscriptionNewHeads, subscriptionFailed, err)
+		}
+
+		/* subscription failed, wait before resubscribing */
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(conf.GetConf().ConfirmationSleepSeconds()) * time.Second):
+		}
+	}
+}
+
+func (l *Listener) confirmOnNewHeads(ctx context.Context, headsChan chan *eth.Header, subscription ethereum.Subscription) {
+	defer subscription.Unsubscribe()
+	l.tracker.setSubscription(subscriptionNewHeads, subscriptionActive, nil)
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.tracker.setSubscription(subscriptionNewHeads, subscriptionStopped, nil)
+			return
+		case err := <-subscription.Err():
+			if err == nil {
+				/* channel closed without an error, resubscribed like a failure */
+				err = errors.New("subscription closed")
+			}
+			logger.Error("new heads subscription failed", logger.String("message", err.Error()))
+			l.tracker.setSubscription(subscriptionNewHeads, subscriptionFailed, err)
+			return
+		case head := <-headsChan:
+			head = latestHead(headsChan, head)
+			l.headers.Add(head)
+			l.tracker.setHead(head)
+			metrics.HeadBlock.Set(float64(head.Number.Uint64()))
+			from := head.Number
 			if l.queue.Length() > 0 {
-				latestBlock, err := eth.Client.BlockNumber(context.Background())
-				if err != nil {
-					logger.Error("could not update current block number", logger.String("message", err.Error()))
+				from = l.queue.FirstEventBlockNumber()
+			}
+			confirmedThrough, err := l.policy.ConfirmedThrough(ctx, head, from)
+			if err != nil {
+				logger.Error("could not get confirmed block", logger.String("policy", l.policy.Name()), logger.String("message", err.Error()))
+				continue
+			}
+			if l.queue.Length() == 0 {
+				l.setConfirmed(head, confirmedThrough)
+				l.saveCheckpoint(confirmedThrough)
+				continue
+			}
+			if stamped, ok := l.policy.(confirmation.StampedPolicy); ok {
+				confirmedThrough = stamped.ConfirmedThroughEvents(head, l.queue.Events(), confirmedThrough)
+			}
+			if l.scrapAndConfirm(ctx, head.Number, confirmedThrough) {
+				l.setConfirmed(head, confirmedThrough)
+				for _, leftover := range l.queue.RemoveLeftoverEvents(confirmedThrough) {
+					metrics.EventsLeftover.Inc()
+					l.retract(leftover)
 				}
-				latestBlockBig, _ := big.NewInt(0).SetString(strconv.FormatUint(latestBlock, 10), 10)
-				l.scrapAndConfirm(latestBlockBig)
-				l.queue.RemoveLeftoverEvents(latestBlockBig)
-				time.Sleep(time.Duration(l.confirmDelay) * time.Second)
+				metrics.QueueDepth.Set(float64(l.queue.Length()))
+				l.saveCheckpoint(confirmedThrough)
 			}
 		}
 	}
 }
 
-func (l *Listener) scrapAndConfirm(latestBlock *big.Int) {
+/* skips heads that piled up while confirming, confirming against the latest is enough */
+func latestHead(headsChan chan *eth.Header, head *eth.Header) *eth.Header {
+	for {
+		select {
+		case next := <-headsChan:
+			head = next
+		default:
+			return head
+		}
+	}
+}
+
+/* lag is how far the confirmed block is behind head, so it stays at the policy depth while no event is waiting */
+func (l *Listener) setConfirmed(head *eth.Header, confirmedThrough *big.Int) {
+	l.tracker.setLastConfirmed(confirmedThrough)
+	metrics.ConfirmedBlock.Set(float64(confirmedThrough.Int64()))
+	metrics.LagBlocks.Set(float64(new(big.Int).Sub(head.Number, confirmedThrough).Int64()))
+}
+
+/* returns false if confirmation did not go through every confirmed log, so leftovers are kept */
+func (l *Listener) scrapAndConfirm(ctx context.Context, latestBlock *big.Int, confirmedThrough *big.Int) bool {
 	eth := eth.GetEth()
 
 	query := ethereum.FilterQuery{
 		FromBlock: l.queue.FirstEventBlockNumber(),
-		ToBlock:   nil, /* nil will query to latest block */
+		ToBlock:   latestBlock,
 		Addresses: []common.Address{
 			common.HexToAddress(l.contractAddress),
 		},
 	}
 
-	logs, err := eth.Client.FilterLogs(context.Background(), query)
+	scanStart := time.Now()
+	observe := metrics.ObserveRPC("eth_getLogs")
+	logs, err := eth.Client.FilterLogs(ctx, query)
+	observe(err)
+	scanEnd := time.Now()
 	if err != nil {
 		logger.Error("could not query contract logs", logger.String("message", err.Error()))
+		return false
 	}
 
+	confirmed := []domain.GenericEvent{}
 	for _, scrappedEvent := range logs {
 		listenedEventType := eventSignatureToType[scrappedEvent.Topics[0].Hex()]
 		if len(listenedEventType) == 0 {
@@ -127,54 +455,151 @@ func (l *Listener) scrapAndConfirm(latestBlock *big.Int) {
 		}
 		event := scrappedToGeneric(scrappedEvent)
 		if event.Removed {
-			/* if event was removed, remove it and duplicates from list */
-			l.queue.RemoveEventsLike(event)
+			/* if event was removed, remove it from list */
+			if l.queue.Remove(event) {
+				metrics.EventsReorged.WithLabelValues(event.EventType).Inc()
+				l.retract(event)
+			}
 			continue
 		}
-		if big.NewInt(0).Sub(latestBlock, event.BlockNumber).Cmp(new(big.Int).SetUint64(l.confirmBlocks)) == -1 {
-			/* if latestBlock - eventBlockNumber < confirmationBlocks */
+		if event.BlockNumber.Cmp(confirmedThrough) == 1 {
+			/* if eventBlockNumber > confirmedThrough */
 			/* if event is not yet confirmed, ignore it */
 			continue
 		}
-		if !l.queue.IsEventInList(event) {
+		queued, found := l.queue.Get(event)
+		if !found {
 			/* if event is not in list, ignore it */
 			/* subscribed events might arrive after being added to logs */
 			/* which would make the event be consumed again upon arrival */
 			continue
 		}
-		block, err := eth.Client.BlockByNumber(context.Background(), event.BlockNumber)
-		if err != nil {
-			/* if fail to get block, return to try again */
-			logger.Error("failed to get block", logger.String("message", err.Error()))
-			return
+		event.TraceParent = queued.TraceParent
+		confirmed = append(confirmed, event)
+	}
+
+	/* enrichment and sale attribution change delivered copies only, queued events keep their original fields */
+	delivered := make([]domain.GenericEvent, len(confirmed))
+	copy(delivered, confirmed)
+	if l.transactions != nil && len(delivered) > 0 {
+		l.transactions.Enrich(ctx, delivered)
+	}
+
+	numbers := make([]*big.Int, len(delivered))
+	for i, event := range delivered {
+		numbers[i] = event.BlockNumber
+	}
+	lookupStart := time.Now()
+	headers, err := l.headers.HeadersByNumber(ctx, numbers)
+	lookupEnd := time.Now()
+	if err != nil {
+		/* if fail to get block headers, return to try again */
+		logger.Error("failed to get block headers", logger.String("message", err.Error()))
+		return false
+	}
+
+	for i, event := range delivered {
+		traceCtx := tracing.WithTraceParent(context.Background(), event.TraceParent)
+		traceBetween(traceCtx, "event.confirmation_scan", scanStart, scanEnd, tracing.EventAttributes(&event), trace.WithAttributes(
+			tracing.FromBlock.String(query.FromBlock.String()),
+			tracing.ToBlock.String(query.ToBlock.String()),
+		))
+		traceBetween(traceCtx, "event.block_lookup", lookupStart, lookupEnd, tracing.EventAttributes(&event))
+		confirmCtx, span := tracing.Start(traceCtx, "event.confirm", tracing.EventAttributes(&event), trace.WithAttributes(
+			tracing.Policy.String(l.policy.Name()),
+		))
+
+		header := headers[event.BlockNumber.String()]
+		if header.Hash != event.BlockHash {
+			/* cached header is from a replaced block, evict it and try again on next run */
+			event.Logger().Warn("block hash mismatch", logger.Object("event", &event), logger.String("headerHash", header.Hash))
+			l.headers.Evict(event.BlockNumber)
+			tracing.End(span, errors.New("block hash mismatch"))
+			return false
+		}
+		event.Date = time.Unix(int64(header.Time), 0).Format(time.RFC3339)
+		event.ConfirmedBy = l.policy.Name()
+		if l.twoPhase {
+			event.Status = domain.StatusConfirmed
 		}
-		event.Date = time.Unix(int64(block.Time()), 0).Format(time.RFC3339)
-		l.consume(event)
-		l.queue.RemoveEventsLike(event)
+		l.enrich(ctx, &event)
+		l.sales.Track(ctx, &event)
+		event.TraceParent = tracing.TraceParent(confirmCtx)
+		l.scheduler.Submit(event)
+		l.queue.Confirm(confirmed[i])
+		metrics.EventsConfirmed.WithLabelValues(event.EventType).Inc()
+		span.End()
 	}
+
+	return true
+}
+
+/* metadata is fetched on delivery instead, as a slow token uri would hold back confirmation of every event */
+func (l *Listener) enrich(ctx context.Context, event *domain.GenericEvent) {
+	if l.enricher != nil {
+		l.enricher.Enrich(ctx, event)
+	}
+}
+
+/* records a step shared by every event of a run, such as the scan, in the trace of one event */
+func traceBetween(ctx context.Context, name string, start time.Time, end time.Time, opts ...trace.SpanStartOption) {
+	_, span := tracing.Start(ctx, name, append(opts, trace.WithTimestamp(start))...)
+	span.End(trace.WithTimestamp(end))
+}
+
+func (l *Listener) deliver(ctx context.Context, event domain.GenericEvent) (err error) {
+	ctx, span := tracing.Start(tracing.WithTraceParent(ctx, event.TraceParent), "event.deliver", tracing.EventAttributes(&event), trace.WithAttributes(
+		tracing.Status.String(event.Status),
+	))
+	defer func() { tracing.End(span, err) }()
+	ctx = logger.NewContext(ctx, event.Logger())
+	ctx = journal.WithEventID(ctx, event.ID())
+
+	switch event.Status {
+	case domain.StatusRetracted:
+		retractModel := event.ToRetractEvent()
+		logger.FromContext(ctx).Info("consuming retracted event", logger.Object("event", &retractModel))
+		return l.api.Retract(ctx, retractModel)
+	case domain.StatusPending:
+		return l.consume(ctx, event)
+	}
+
+	/* fetched by the delivery worker of the token, a failed delivery reuses the cached document */
+	if l.metadata != nil && event.Metadata == nil {
+		l.metadata.Enrich(ctx, &event)
+	}
+	if err := l.consume(ctx, event); err != nil {
+		return err
+	}
+	l.projection.Apply(event)
+	/* only now is the event dropped from the queue, a durable queue confirms it again after a crash before this */
+	l.queue.Done(event)
+	return nil
 }
 
-func (l *Listener) consume(generic domain.GenericEvent) {
+func (l *Listener) consume(ctx context.Context, generic domain.GenericEvent) error {
 	switch generic.EventType {
 	case "Create":
 		createModel := generic.ToCreateEvent()
-		logger.Info("consuming create event", logger.Object("event", &createModel))
-		l.api.CreateStar(createModel)
+		logger.FromContext(ctx).Info("consuming create event", logger.Object("event", &createModel))
+		return l.api.CreateStar(ctx, createModel)
 	case "ChangeName":
 		changeNameModel := generic.ToChangeNameEvent()
-		logger.Info("consuming changed name event", logger.Object("event", &changeNameModel))
-		l.api.ChangeName(changeNameModel)
+		logger.FromContext(ctx).Info("consuming changed name event", logger.Object("event", &changeNameModel))
+		return l.api.ChangeName(ctx, changeNameModel)
 	case "PutForSale":
 		putForSaleModel := generic.ToPutForSaleEvent()
-		logger.Info("consuming put for sale event", logger.Object("event", &putForSaleModel))
-		l.api.PutForSale(putForSaleModel)
+		logger.FromContext(ctx).Info("consuming put for sale event", logger.Object("event", &putForSaleModel))
+		return l.api.PutForSale(ctx, putForSaleModel)
 	case "RemoveFromSale":
 		removeFromSaleModel := generic.ToRemoveFromSaleEvent()
-		logger.Info("consuming removed from sale event", logger.Object("event", &removeFromSaleModel))
-		l.api.RemoveFromSale(removeFromSaleModel)
+		logger.FromContext(ctx).Info("consuming removed from sale event", logger.Object("event", &removeFromSaleModel))
+		return l.api.RemoveFromSale(ctx, removeFromSaleModel)
 	case "Purchase":
 		purchaseModel := generic.ToPurchaseEvent()
-		logger.Info("consuming purchase event", logger.Object("event", &purchaseModel))
-		l.api.Purchase(purchaseModel)
+		logger.FromContext(ctx).Info("consuming purchase event", logger.Object("event", &purchaseModel))
+		return l.api.Purchase(ctx, purchaseModel)
 	}
+
+	return nil
 }
@@ -0,0 +1,404 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+	"github.com/sergera/star-notary-listener/internal/tracing"
+)
+
+/* largest block range replayed in one request */
+const maxReplayBlocks = 10000
+
+/* block range of each log query when receiving past events */
+const backfillBlocks = 2000
+
+var ErrCheckpointDisabled = errors.New("checkpoint is not enabled")
+
+var ErrBackfillRunning = errors.New("events after the checkpoint are still being received, try again once done")
+
+/* block through which events after the checkpoint were received, the checkpoint is held at it until none is left */
+type catchUp struct {
+	lock    *sync.Mutex
+	running bool
+	owned   bool     /* the running backfill covers every block left to receive */
+	through *big.Int /* nil when no block is left to receive */
+}
+
+func newCatchUp() *catchUp {
+	return &catchUp{lock: &sync.Mutex{}}
+}
+
+/* holds the checkpoint below from before events after it are received, false if a backfill is running already */
+func (c *catchUp) start(from *big.Int) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.running {
+		return false
+	}
+	c.running = true
+	held := new(big.Int).Sub(from, big.NewInt(1))
+	/* a lower block left by a failed backfill stays held, as this one does not cover it */
+	c.owned = c.through == nil || held.Cmp(c.through) <= 0
+	if c.owned {
+		c.through = held
+	}
+	return true
+}
+
+func (c *catchUp) advance(through *big.Int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.owned {
+		c.through = new(big.Int).Set(through)
+	}
+}
+
+/* releases the checkpoint once every block was received, a failed backfill keeps it held where it stopped */
+func (c *catchUp) finish(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.running = false
+	if err == nil && c.owned {
+		c.through = nil
+	}
+}
+
+/* block the checkpoint is held at, nil if none */
+func (c *catchUp) held() *big.Int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.through == nil {
+		return nil
+	}
+	return new(big.Int).Set(c.through)
+}
+
+func (l *Listener) Pause() {
+	l.scheduler.Pause()
+	logger.Info("delivery paused")
+}
+
+func (l *Listener) Resume() {
+	l.scheduler.Resume()
+	logger.Info("delivery resumed")
+}
+
+func (l *Listener) Paused() bool {
+	return l.scheduler.Paused()
+}
+
+/* delivers the events that exhausted their delivery attempts again, returns how many */
+func (l *Listener) RetryFailed() int {
+	retried := l.scheduler.RetryFailed()
+	logger.Info("retrying failed deliveries", logger.Int("events", retried))
+	return retried
+}
+
+/* gives up on the events that exhausted their delivery attempts, so the events of their tokens are delivered, returns how many */
+func (l *Listener) DropFailed() int {
+	dropped := l.scheduler.DropFailed()
+	for _, event := range dropped {
+		event.Logger().Warn("dropping failed delivery", logger.Object("event", &event))
+		l.queue.Done(event)
+	}
+	return len(dropped)
+}
+
+/* delivers every event of a confirmed block range again, returns how many were submitted */
+func (l *Listener) Replay(ctx context.Context, from *big.Int, to *big.Int) (int, error) {
+	if from.Sign() < 0 || to.Cmp(from) == -1 {
+		return 0, fmt.Errorf("invalid block range %s to %s", from.String(), to.String())
+	}
+	if new(big.Int).Sub(to, from).Cmp(big.NewInt(maxReplayBlocks)) >= 0 {
+		return 0, fmt.Errorf("block range is larger than %d blocks", maxReplayBlocks)
+	}
+	if err := l.checkConfirmed(ctx, from, to); err != nil {
+		return 0, err
+	}
+
+	logs, err := l.filterLogs(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	events := []domain.GenericEvent{}
+	for _, log := range logs {
+		if len(eventSignatureToType[log.Topics[0].Hex()]) == 0 || log.Removed {
+			continue
+		}
+		events = append(events, scrappedToGeneric(log))
+	}
+
+	logger.Info("replaying block range", logger.String("from", from.String()), logger.String("to", to.String()), logger.Int("events", len(events)))
+	return l.submitAgain(ctx, events, "event.replay")
+}
+
+/* delivers a single confirmed event again */
+func (l *Listener) Redeliver(ctx context.Context, txHash string, logIndex uint) error {
+	eth := eth.GetEth()
+
+	observe := metrics.ObserveRPC("eth_getTransactionReceipt")
+	receipt, err := eth.Client.TransactionReceipt(ctx, common.HexToHash(txHash))
+	observe(err)
+	if err != nil {
+		return fmt.Errorf("could not get transaction receipt: %w", err)
+	}
+
+	for _, log := range receipt.Logs {
+		if log.Index != logIndex {
+			continue
+		}
+		if !strings.EqualFold(log.Address.Hex(), l.contractAddress) || len(eventSignatureToType[log.Topics[0].Hex()]) == 0 {
+			return fmt.Errorf("log %d of transaction %s is not a contract event", logIndex, txHash)
+		}
+		if err := l.checkConfirmed(ctx, receipt.BlockNumber, receipt.BlockNumber); err != nil {
+			return err
+		}
+
+		logger.Info("redelivering event", logger.String("txHash", txHash), logger.Uint("logIndex", logIndex))
+		_, err := l.submitAgain(ctx, []domain.GenericEvent{scrappedToGeneric(*log)}, "event.redeliver")
+		return err
+	}
+
+	return fmt.Errorf("transaction %s has no log %d", txHash, logIndex)
+}
+
+/* delivers every event of a confirmed block range without listening, waiting until they are delivered or ctx is done */
+/* to defaults to the latest confirmed block, returns how many were submitted and the events left undelivered */
+func (l *Listener) Backfill(ctx context.Context, from *big.Int, to *big.Int) (int, []domain.GenericEvent, error) {
+	head, err := eth.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not get latest block: %w", err)
+	}
+	l.headers.Add(head)
+	l.tracker.setHead(head)
+
+	if to == nil {
+		if to, err = l.policy.ConfirmedThrough(ctx, head, from); err != nil {
+			return 0, nil, fmt.Errorf("could not get confirmed block: %w", err)
+		}
+	}
+	if from.Sign() < 0 || to.Cmp(from) == -1 {
+		return 0, nil, fmt.Errorf("invalid block range %s to %s", from.String(), to.String())
+	}
+
+	l.scheduler.Start()
+	submitted := 0
+	for start := new(big.Int).Set(from); start.Cmp(to) <= 0 && err == nil; start.Add(start, big.NewInt(maxReplayBlocks)) {
+		end := new(big.Int).Add(start, big.NewInt(maxReplayBlocks-1))
+		if end.Cmp(to) == 1 {
+			end.Set(to)
+		}
+		var replayed int
+		replayed, err = l.Replay(ctx, start, end)
+		submitted += replayed
+	}
+
+	return submitted, l.scheduler.Stop(ctx), err
+}
+
+/* the block the listener resumes from, false if there is none */
+func (l *Listener) Checkpoint() (*big.Int, bool) {
+	if l.checkpoint == nil {
+		return nil, false
+	}
+	return l.checkpoint.Block()
+}
+
+/* sets the block the listener resumes from, events after a lower block are received again right away */
+/* as they are received within the request, a lower block may be at most maxReplayBlocks behind the latest block */
+/* the confirmation loop only moves a lower block on once the events after it were received */
+func (l *Listener) SetCheckpoint(ctx context.Context, block *big.Int) error {
+	if l.checkpoint == nil {
+		return ErrCheckpointDisabled
+	}
+	if block.Sign() < 0 {
+		return fmt.Errorf("invalid block %s", block.String())
+	}
+
+	current, found := l.checkpoint.Block()
+	receive := !found || block.Cmp(current) == -1
+	if receive {
+		observe := metrics.ObserveRPC("eth_blockNumber")
+		latest, err := eth.GetEth().Client.BlockNumber(ctx)
+		observe(err)
+		if err != nil {
+			return fmt.Errorf("could not get latest block: %w", err)
+		}
+		if new(big.Int).Sub(new(big.Int).SetUint64(latest), block).Cmp(big.NewInt(maxReplayBlocks)) >= 0 {
+			return fmt.Errorf("block is %d or more blocks behind the latest block, use the backfill command instead", maxReplayBlocks)
+		}
+		/* held before saving, so the confirmation loop does not move it on in between */
+		if !l.catchUp.start(new(big.Int).Add(block, big.NewInt(1))) {
+			return ErrBackfillRunning
+		}
+	}
+
+	if err := l.checkpoint.Save(block); err != nil {
+		if receive {
+			l.catchUp.finish(err)
+		}
+		return err
+	}
+	logger.Info("checkpoint set", logger.String("block", block.String()))
+
+	if !receive {
+		return nil
+	}
+	return l.backfill(ctx, new(big.Int).Add(block, big.NewInt(1)))
+}
+
+/* saves the highest block through which every event was delivered, events still queued, undelivered or failed hold it back */
+/* as do blocks after the checkpoint whose events are still being received */
+func (l *Listener) saveCheckpoint(confirmedThrough *big.Int) {
+	if l.checkpoint == nil {
+		return
+	}
+
+	through := new(big.Int).Set(confirmedThrough)
+	if l.queue.Length() > 0 {
+		if first := new(big.Int).Sub(l.queue.FirstEventBlockNumber(), big.NewInt(1)); first.Cmp(through) == -1 {
+			through = first
+		}
+	}
+	if oldest := l.scheduler.OldestBlock(); oldest != nil {
+		if undelivered := new(big.Int).Sub(oldest, big.NewInt(1)); undelivered.Cmp(through) == -1 {
+			through = undelivered
+		}
+	}
+	if held := l.catchUp.held(); held != nil && held.Cmp(through) == -1 {
+		/* blocks after it were not received yet */
+		through = held
+	}
+	if through.Sign() < 0 {
+		return
+	}
+
+	if err := l.checkpoint.Save(through); err != nil {
+		logger.Error("could not save checkpoint", logger.String("message", err.Error()))
+	}
+}
+
+/* receives the events emitted from a block on, as if they came from the subscriptions, a page at a time */
+/* called after catchUp.start, the checkpoint is held at the last page received until every page is */
+func (l *Listener) backfill(ctx context.Context, from *big.Int) (err error) {
+	defer func() { l.catchUp.finish(err) }()
+
+	observe := metrics.ObserveRPC("eth_blockNumber")
+	latest, err := eth.GetEth().Client.BlockNumber(ctx)
+	observe(err)
+	if err != nil {
+		return err
+	}
+
+	received := 0
+	latestBig := new(big.Int).SetUint64(latest)
+	for start := new(big.Int).Set(from); start.Cmp(latestBig) <= 0; start.Add(start, big.NewInt(backfillBlocks)) {
+		end := new(big.Int).Add(start, big.NewInt(backfillBlocks-1))
+		if end.Cmp(latestBig) == 1 {
+			end.Set(latestBig)
+		}
+
+		logs, err := l.filterLogs(ctx, start, end)
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			if len(eventSignatureToType[log.Topics[0].Hex()]) == 0 || log.Removed {
+				continue
+			}
+			l.receive(ctx, scrappedToGeneric(log))
+			received++
+		}
+		if ctx.Err() != nil {
+			/* events of the page might not have been queued */
+			return ctx.Err()
+		}
+		l.catchUp.advance(end)
+		logger.Info("received past events", logger.String("from", start.String()), logger.String("to", end.String()), logger.Uint64("latest", latest))
+	}
+
+	logger.Info("caught up with past events", logger.String("from", from.String()), logger.Uint64("to", latest), logger.Int("events", received))
+	return nil
+}
+
+func (l *Listener) filterLogs(ctx context.Context, from *big.Int, to *big.Int) ([]types.Log, error) {
+	observe := metrics.ObserveRPC("eth_getLogs")
+	logs, err := eth.GetEth().Client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Addresses: []common.Address{common.HexToAddress(l.contractAddress)},
+	})
+	observe(err)
+	return logs, err
+}
+
+/* events are only delivered again once their blocks are confirmed by the policy */
+func (l *Listener) checkConfirmed(ctx context.Context, from *big.Int, to *big.Int) error {
+	head := l.tracker.latestHead()
+	if head == nil {
+		return errors.New("no block seen yet, try again shortly")
+	}
+
+	confirmedThrough, err := l.policy.ConfirmedThrough(ctx, head, from)
+	if err != nil {
+		return fmt.Errorf("could not get confirmed block: %w", err)
+	}
+	if to.Cmp(confirmedThrough) == 1 {
+		return fmt.Errorf("block %s is not confirmed, confirmed through %s", to.String(), confirmedThrough.String())
+	}
+	return nil
+}
+
+/* delivers events again through the confirmation path, without changing tracked sales */
+func (l *Listener) submitAgain(ctx context.Context, events []domain.GenericEvent, spanName string) (int, error) {
+	if l.transactions != nil && len(events) > 0 {
+		l.transactions.Enrich(ctx, events)
+	}
+
+	numbers := make([]*big.Int, len(events))
+	for i, event := range events {
+		numbers[i] = event.BlockNumber
+	}
+	headers, err := l.headers.HeadersByNumber(ctx, numbers)
+	if err != nil {
+		return 0, fmt.Errorf("could not get block headers: %w", err)
+	}
+
+	submitted := 0
+	for _, event := range events {
+		header := headers[event.BlockNumber.String()]
+		if header.Hash != event.BlockHash {
+			l.headers.Evict(event.BlockNumber)
+			return submitted, fmt.Errorf("block %s was replaced, try again", event.BlockNumber.String())
+		}
+
+		traceCtx, span := tracing.Start(context.Background(), spanName, tracing.EventAttributes(&event))
+		event.TraceParent = tracing.TraceParent(traceCtx)
+		event.Date = time.Unix(int64(header.Time), 0).Format(time.RFC3339)
+		event.ConfirmedBy = l.policy.Name()
+		if l.twoPhase {
+			event.Status = domain.StatusConfirmed
+		}
+		l.enrich(ctx, &event)
+		l.sales.AttributeFromChain(ctx, &event)
+		l.scheduler.Submit(event)
+		span.End()
+		submitted++
+	}
+
+	return submitted, nil
+}
@@ -0,0 +1,197 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+)
+
+const (
+	subscriptionActive  = "active"
+	subscriptionFailed  = "failed"
+	subscriptionStopped = "stopped"
+)
+
+const (
+	subscriptionCreate         = "create"
+	subscriptionChangeName     = "changeName"
+	subscriptionPutForSale     = "putForSale"
+	subscriptionRemoveFromSale = "removeFromSale"
+	subscriptionPurchase       = "purchase"
+	subscriptionNewHeads       = "newHeads"
+)
+
+/* subscriptions that must be active for the listener to be ready */
+var subscriptionNames = []string{
+	subscriptionCreate,
+	subscriptionChangeName,
+	subscriptionPutForSale,
+	subscriptionRemoveFromSale,
+	subscriptionPurchase,
+	subscriptionNewHeads,
+}
+
+/* readiness checks give up after this long */
+const readyTimeout = 5 * time.Second
+
+type SubscriptionStatus struct {
+	State string `json:"state"`
+	Since string `json:"since"`
+	Error string `json:"error,omitempty"`
+}
+
+type Status struct {
+	HeadBlock          string                        `json:"head_block"`
+	HeadTime           string                        `json:"head_time"`
+	LastConfirmedBlock string                        `json:"last_confirmed_block"`
+	QueueLength        int                           `json:"queue_length"`
+	LagBlocks          string                        `json:"lag_blocks"`
+	LagSeconds         uint64                        `json:"lag_seconds"`
+	DeliveryPending    int                           `json:"delivery_pending"`
+	DeliveryFailed     int                           `json:"delivery_failed"`
+	DeliveryPaused     bool                          `json:"delivery_paused"`
+	CheckpointBlock    string                        `json:"checkpoint_block,omitempty"`
+	Subscriptions      map[string]SubscriptionStatus `json:"subscriptions"`
+}
+
+/* progress of the listener, updated by intake and confirmation and read by probes */
+type tracker struct {
+	lock          *sync.RWMutex
+	head          *eth.Header
+	lastConfirmed *big.Int
+	subscriptions map[string]SubscriptionStatus
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		lock:          &sync.RWMutex{},
+		lastConfirmed: new(big.Int),
+		subscriptions: map[string]SubscriptionStatus{},
+	}
+}
+
+func (t *tracker) setHead(head *eth.Header) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.head = head
+}
+
+func (t *tracker) setLastConfirmed(confirmedThrough *big.Int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastConfirmed = new(big.Int).Set(confirmedThrough)
+}
+
+/* whether a confirmation run went through since start */
+func (t *tracker) confirmed() bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.lastConfirmed.Sign() > 0
+}
+
+func (t *tracker) lastConfirmedBlock() *big.Int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return new(big.Int).Set(t.lastConfirmed)
+}
+
+func (t *tracker) latestHead() *eth.Header {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.head
+}
+
+func (t *tracker) setSubscription(name string, state string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	status := SubscriptionStatus{State: state, Since: time.Now().UTC().Format(time.RFC3339)}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	t.subscriptions[name] = status
+}
+
+/* follows a subscription until it fails or is unsubscribed */
+func (t *tracker) monitor(name string, subscription event.Subscription) {
+	t.setSubscription(name, subscriptionActive, nil)
+	if err := <-subscription.Err(); err != nil {
+		t.setSubscription(name, subscriptionFailed, err)
+		return
+	}
+	t.setSubscription(name, subscriptionStopped, nil)
+}
+
+func (l *Listener) Status(ctx context.Context) Status {
+	l.tracker.lock.RLock()
+	head := l.tracker.head
+	lastConfirmed := new(big.Int).Set(l.tracker.lastConfirmed)
+	subscriptions := make(map[string]SubscriptionStatus, len(l.tracker.subscriptions))
+	for name, subscription := range l.tracker.subscriptions {
+		subscriptions[name] = subscription
+	}
+	l.tracker.lock.RUnlock()
+
+	status := Status{
+		LastConfirmedBlock: lastConfirmed.String(),
+		QueueLength:        l.queue.Length(),
+		LagBlocks:          "0",
+		DeliveryPending:    l.scheduler.Pending(),
+		DeliveryFailed:     len(l.scheduler.Failed()),
+		DeliveryPaused:     l.scheduler.Paused(),
+		Subscriptions:      subscriptions,
+	}
+	if block, found := l.Checkpoint(); found {
+		status.CheckpointBlock = block.String()
+	}
+	if head == nil {
+		return status
+	}
+	status.HeadBlock = head.Number.String()
+	status.HeadTime = time.Unix(int64(head.Time), 0).UTC().Format(time.RFC3339)
+
+	/* lag is how far the confirmed block is behind head */
+	if lastConfirmed.Sign() > 0 && head.Number.Cmp(lastConfirmed) == 1 {
+		status.LagBlocks = new(big.Int).Sub(head.Number, lastConfirmed).String()
+		headers, err := l.headers.HeadersByNumber(ctx, []*big.Int{lastConfirmed})
+		if err == nil && headers[lastConfirmed.String()].Time < head.Time {
+			status.LagSeconds = head.Time - headers[lastConfirmed.String()].Time
+		}
+	}
+
+	return status
+}
+
+/* returns every reason the listener is not ready, none if it is */
+func (l *Listener) Ready(ctx context.Context) []error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	reasons := []error{}
+	observe := metrics.ObserveRPC("eth_blockNumber")
+	_, err := eth.GetEth().Client.BlockNumber(ctx)
+	observe(err)
+	if err != nil {
+		reasons = append(reasons, errors.New("rpc provider unreachable: "+err.Error()))
+	}
+
+	l.tracker.lock.RLock()
+	for _, name := range subscriptionNames {
+		subscription, exists := l.tracker.subscriptions[name]
+		if !exists || subscription.State != subscriptionActive {
+			reasons = append(reasons, errors.New("subscription "+name+" is not active"))
+		}
+	}
+	l.tracker.lock.RUnlock()
+
+	if err := l.api.Reachable(ctx); err != nil {
+		reasons = append(reasons, errors.New("star notary api unreachable: "+err.Error()))
+	}
+
+	return reasons
+}
@@ -1,7 +1,10 @@
 package logger
 
 import (
+	"context"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/sergera/star-notary-listener/internal/conf"
 	"go.uber.org/zap"
@@ -11,6 +14,9 @@ import (
 
 var logger *zap.Logger
 
+/* shared by every output, so the level can change while running */
+var level = zap.NewAtomicLevel()
+
 /* function variables for zap field types */
 var (
 	Skip        = zap.Skip
@@ -66,11 +72,19 @@ var (
 
 /* type variables for zap encoder types */
 type (
+	Field                 = zapcore.Field
 	ObjectEncoder         = zapcore.ObjectEncoder
 	ArrayEncoder          = zapcore.ArrayEncoder
 	PrimitiveArrayEncoder = zapcore.PrimitiveArrayEncoder
 )
 
+/* child logger carrying fields that are added to every message it logs */
+type Logger struct {
+	logger *zap.Logger
+}
+
+type contextKey struct{}
+
 func Setup() {
 	logger = newLogger()
 }
@@ -94,26 +108,75 @@ func newEncoderConfig() zapcore.EncoderConfig {
 
 func newLogger() *zap.Logger {
 	conf := conf.GetConf()
-	consoleEncoder := zapcore.NewConsoleEncoder(newEncoderConfig())
-	fileEncoder := zapcore.NewJSONEncoder(newEncoderConfig())
-
-	consoleSyncer := zapcore.AddSync(os.Stderr)
-	fileSyncer := zapcore.AddSync(&lumberjack.Logger{
-		Filename:   conf.LogPath() + "star-notary-listener.log",
-		MaxSize:    5, // megabytes
-		MaxBackups: 3,
-	})
-
-	levelEnabler := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= zapcore.DebugLevel
-	})
-
-	core := zapcore.NewTee(
-		zapcore.NewCore(consoleEncoder, consoleSyncer, levelEnabler),
-		zapcore.NewCore(fileEncoder, fileSyncer, levelEnabler),
+
+	if err := SetLevel(conf.LogLevel()); err != nil {
+		panic(err)
+	}
+
+	cores := []zapcore.Core{
+		zapcore.NewCore(newEncoder(conf.LogConsoleFormat()), zapcore.AddSync(os.Stderr), level),
+	}
+
+	if conf.LogFileEnabled() {
+		fileSyncer := zapcore.AddSync(&lumberjack.Logger{
+			Filename:   filepath.Join(conf.LogPath(), "star-notary-listener.log"),
+			MaxSize:    int(conf.LogMaxSizeMB()),
+			MaxAge:     int(conf.LogMaxAgeDays()),
+			MaxBackups: int(conf.LogMaxBackups()),
+			Compress:   conf.LogCompress(),
+		})
+		cores = append(cores, zapcore.NewCore(newEncoder(conf.LogFileFormat()), fileSyncer, level))
+	}
+
+	return zap.New(sampled(zapcore.NewTee(cores...), conf.LogSampleInitial(), conf.LogSampleThereafter()), zap.AddCaller(), zap.AddCallerSkip(1))
+}
+
+/*
+samples debug and info messages, logging the first initial messages of each level and text every second,
+then one of every thereafter, warnings and errors are always logged
+*/
+func sampled(core zapcore.Core, initial uint64, thereafter uint64) zapcore.Core {
+	if initial == 0 {
+		return core
+	}
+	return zapcore.NewTee(
+		zapcore.NewSamplerWithOptions(&levelFilter{core, func(l zapcore.Level) bool { return l < zapcore.WarnLevel }}, time.Second, int(initial), int(thereafter)),
+		&levelFilter{core, func(l zapcore.Level) bool { return l >= zapcore.WarnLevel }},
 	)
+}
+
+/* core that only writes the levels it accepts, on top of the level of the wrapped core */
+type levelFilter struct {
+	zapcore.Core
+	accepts func(l zapcore.Level) bool
+}
+
+func (f *levelFilter) Enabled(l zapcore.Level) bool {
+	return f.accepts(l) && f.Core.Enabled(l)
+}
+
+func (f *levelFilter) With(fields []zapcore.Field) zapcore.Core {
+	return &levelFilter{f.Core.With(fields), f.accepts}
+}
+
+func (f *levelFilter) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !f.accepts(entry.Level) {
+		return checked
+	}
+	return f.Core.Check(entry, checked)
+}
+
+/* returns a json encoder for "json" and a console encoder otherwise */
+func newEncoder(format string) zapcore.Encoder {
+	if format == "json" {
+		return zapcore.NewJSONEncoder(newEncoderConfig())
+	}
+	return zapcore.NewConsoleEncoder(newEncoderConfig())
+}
 
-	return zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))
+/* sets the lowest level logged, one of debug, info, warn or error */
+func SetLevel(name string) error {
+	return level.UnmarshalText([]byte(name))
 }
 
 func Sync() error {
@@ -123,6 +186,44 @@ func Sync() error {
 	return nil
 }
 
+/* returns a child logger that adds fields to every message */
+func With(fields ...zapcore.Field) *Logger {
+	return &Logger{logger.With(fields...)}
+}
+
+/* returns a context carrying l, for steps that only receive a context */
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+/* returns the logger carried by ctx, or the root logger if there is none */
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return &Logger{logger}
+}
+
+func (l *Logger) With(fields ...zapcore.Field) *Logger {
+	return &Logger{l.logger.With(fields...)}
+}
+
+func (l *Logger) Debug(msg string, fields ...zapcore.Field) {
+	l.logger.Debug(msg, fields...)
+}
+
+func (l *Logger) Info(msg string, fields ...zapcore.Field) {
+	l.logger.Info(msg, fields...)
+}
+
+func (l *Logger) Warn(msg string, fields ...zapcore.Field) {
+	l.logger.Warn(msg, fields...)
+}
+
+func (l *Logger) Error(msg string, fields ...zapcore.Field) {
+	l.logger.Error(msg, fields...)
+}
+
 func Debug(msg string, fields ...zapcore.Field) {
 	logger.Debug(msg, fields...)
 }
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "star_notary_listener"
+
+var (
+	EventsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_received_total",
+		Help:      "Contract events received from subscriptions, by event type.",
+	}, []string{"type"})
+
+	EventsConfirmed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_confirmed_total",
+		Help:      "Events confirmed and submitted for delivery, by event type.",
+	}, []string{"type"})
+
+	EventsLeftover = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_leftover_total",
+		Help:      "Pending events dropped because their log was not found once their block was confirmed.",
+	})
+
+	EventsReorged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_reorged_total",
+		Help:      "Pending events removed because their log was reorged out, by event type.",
+	}, []string{"type"})
+
+	DeliveryAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "delivery_attempts_total",
+		Help:      "Requests made to the star notary api, by route.",
+	}, []string{"route"})
+
+	DeliveryFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "delivery_failures_total",
+		Help:      "Requests to the star notary api that failed or were not successful, by route.",
+	}, []string{"route"})
+
+	DeliveryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delivery_duration_seconds",
+		Help:      "Latency of requests to the star notary api, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route"})
+
+	RPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of calls to the RPC provider, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Calls to the RPC provider that returned an error, by method.",
+	}, []string{"method"})
+
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Events waiting for confirmation.",
+	})
+
+	HeadBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "head_block",
+		Help:      "Latest block number seen.",
+	})
+
+	ConfirmedBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "confirmed_block",
+		Help:      "Block number events were last confirmed through.",
+	})
+
+	LagBlocks = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "lag_blocks",
+		Help:      "Blocks between head and the block events were last confirmed through.",
+	})
+)
+
+/* times a call to the RPC provider, the returned function must be called with the call error */
+func ObserveRPC(method string) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		RPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		if err != nil {
+			RPCErrors.WithLabelValues(method).Inc()
+		}
+	}
+}
+
+/* times a request to the star notary api, the returned function must be called with the request error */
+func ObserveDelivery(route string) func(err error) {
+	start := time.Now()
+	DeliveryAttempts.WithLabelValues(route).Inc()
+	return func(err error) {
+		DeliveryDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		if err != nil {
+			DeliveryFailures.WithLabelValues(route).Inc()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package projection
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/sergera/star-notary-listener/internal/domain"
+)
+
+type Star struct {
+	TokenId      string
+	Owner        string
+	Name         string
+	Coordinates  string
+	PriceInEther *big.Float
+}
+
+type Projection struct {
+	lock  *sync.RWMutex
+	stars map[string]Star
+}
+
+func NewProjection() *Projection {
+	return &Projection{
+		lock:  &sync.RWMutex{},
+		stars: map[string]Star{},
+	}
+}
+
+func (p *Projection) Apply(event domain.GenericEvent) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	star := p.stars[event.TokenId]
+	star.TokenId = event.TokenId
+	if star.PriceInEther == nil {
+		star.PriceInEther = big.NewFloat(0)
+	}
+
+	switch event.EventType {
+	case "Create":
+		star.Owner = event.Sender
+		star.Name = event.Name
+		star.Coordinates = event.Coordinates
+	case "ChangeName":
+		star.Name = event.Name
+	case "PutForSale":
+		star.PriceInEther = event.PriceInEther
+	case "RemoveFromSale":
+		star.PriceInEther = big.NewFloat(0)
+	case "Purchase":
+		star.Owner = event.Sender
+		star.PriceInEther = big.NewFloat(0)
+	default:
+		return
+	}
+
+	p.stars[event.TokenId] = star
+}
+
+func (p *Projection) Set(star Star) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stars[star.TokenId] = star
+}
+
+func (p *Projection) Get(tokenId string) (Star, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	star, exists := p.stars[tokenId]
+	return star, exists
+}
+
+func (p *Projection) Length() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.stars)
+}
+
+func (p *Projection) TokenIds() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	tokenIds := make([]string, 0, len(p.stars))
+	for tokenId := range p.stars {
+		tokenIds = append(tokenIds, tokenId)
+	}
+	return tokenIds
+}
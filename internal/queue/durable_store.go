@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+const walFileName = "pending-events.wal"
+
+const (
+	walInsert = "insert"
+	walRemove = "remove"
+)
+
+type walRecord struct {
+	Op    string              `json:"op"`
+	Event domain.GenericEvent `json:"event"`
+}
+
+/* pending store backed by a write-ahead log, so unconfirmed events survive restarts */
+/* records are written under the pending store lock, in the same order as the changes they record */
+type DurableStore struct {
+	*PendingStore
+	path         string
+	file         *os.File
+	records      uint64 /* records appended since last compaction */
+	compactAfter uint64
+	recovered    []domain.GenericEvent
+}
+
+func NewDurableStore() *DurableStore {
+	conf := conf.GetConf()
+	s := &DurableStore{
+		PendingStore: NewPendingStore(),
+		path:         filepath.Join(conf.QueuePath(), walFileName),
+		compactAfter: conf.QueueCompactAfter(),
+	}
+	s.replay()
+	s.compact()
+	s.PendingStore.record = s.append
+	return s
+}
+
+func (s *DurableStore) replay() {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.Panic("could not open pending events log", logger.String("message", err.Error()))
+	}
+	defer file.Close()
+
+	pending := map[string]domain.GenericEvent{}
+	order := []string{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			/* a torn write from a crash can only be the last record */
+			logger.Warn("skipping unreadable pending events log record", logger.String("message", err.Error()))
+			continue
+		}
+		id := record.Event.ID()
+		switch record.Op {
+		case walInsert:
+			if _, exists := pending[id]; !exists {
+				order = append(order, id)
+			}
+			pending[id] = record.Event
+		case walRemove:
+			delete(pending, id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("could not read pending events log", logger.String("message", err.Error()))
+	}
+
+	for _, id := range order {
+		if event, exists := pending[id]; exists {
+			/* recovered events may outnumber the capacity, if it was lowered since they were written */
+			s.PendingStore.insertRecovered(event)
+			s.recovered = append(s.recovered, event)
+		}
+	}
+
+	logger.Info("recovered pending events", logger.Int("count", len(s.recovered)))
+}
+
+/* events read back from disk on startup, which must be verified against the chain before confirmation */
+func (s *DurableStore) Recovered() []domain.GenericEvent {
+	return s.recovered
+}
+
+/* called by the pending store with its lock held */
+func (s *DurableStore) append(op string, event domain.GenericEvent) {
+	line, err := json.Marshal(walRecord{op, event})
+	if err != nil {
+		logger.Error("could not encode pending events log record", logger.String("message", err.Error()))
+		return
+	}
+
+	if s.file == nil {
+		logger.Error("pending events log is closed, record not written", logger.String("op", op))
+		return
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		logger.Error("could not write pending events log", logger.String("message", err.Error()))
+		return
+	}
+	if err := s.file.Sync(); err != nil {
+		logger.Error("could not sync pending events log", logger.String("message", err.Error()))
+	}
+
+	s.records++
+	if s.compactAfter > 0 && s.records >= s.compactAfter {
+		s.compactLocked()
+	}
+}
+
+func (s *DurableStore) compact() {
+	s.PendingStore.lock.Lock()
+	defer s.PendingStore.lock.Unlock()
+	s.compactLocked()
+}
+
+/* rewrites the log with one insert per pending or undelivered event, replacing it atomically */
+func (s *DurableStore) compactLocked() {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		logger.Panic("could not create pending events log", logger.String("message", err.Error()))
+	}
+
+	writer := bufio.NewWriter(tmp)
+	events := s.PendingStore.retained()
+	for _, event := range events {
+		line, err := json.Marshal(walRecord{walInsert, event})
+		if err != nil {
+			logger.Error("could not encode pending events log record", logger.String("message", err.Error()))
+			continue
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		logger.Panic("could not write pending events log", logger.String("message", err.Error()))
+	}
+	if err := tmp.Sync(); err != nil {
+		logger.Panic("could not sync pending events log", logger.String("message", err.Error()))
+	}
+	tmp.Close()
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		logger.Panic("could not replace pending events log", logger.String("message", err.Error()))
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		logger.Panic("could not open pending events log", logger.String("message", err.Error()))
+	}
+	s.file = file
+	s.records = 0
+	logger.Debug("compacted pending events log", logger.Int("events", len(events)))
+}
+
+func (s *DurableStore) Close() error {
+	s.PendingStore.lock.Lock()
+	defer s.PendingStore.lock.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
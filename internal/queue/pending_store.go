@@ -0,0 +1,288 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+/* pending events indexed by id and ordered by (block, log index) */
+type PendingStore struct {
+	lock     *sync.Mutex
+	notFull  *sync.Cond
+	byId     map[string]*pendingEvent
+	ordered  pendingHeap
+	capacity int
+	/* confirmed events kept until delivered, so a durable log still holds them if the process stops before */
+	confirmed map[string]domain.GenericEvent
+	/* called under the lock on every change, so changes are recorded in the order they happen */
+	record func(op string, event domain.GenericEvent)
+}
+
+type pendingEvent struct {
+	event domain.GenericEvent
+	index int
+}
+
+func NewPendingStore() *PendingStore {
+	conf := conf.GetConf()
+	lock := &sync.Mutex{}
+	return &PendingStore{
+		lock:      lock,
+		notFull:   sync.NewCond(lock),
+		byId:      map[string]*pendingEvent{},
+		ordered:   pendingHeap{},
+		capacity:  int(conf.QueueCapacity()),
+		confirmed: map[string]domain.GenericEvent{},
+	}
+}
+
+func (s *PendingStore) Length() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.ordered)
+}
+
+func (s *PendingStore) FirstEventBlockNumber() *big.Int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.ordered) > 0 {
+		return new(big.Int).Set(s.ordered[0].event.BlockNumber)
+	}
+
+	return new(big.Int)
+}
+
+/* blocks while the store is full, so intake slows down until events are confirmed or ctx is done */
+func (s *PendingStore) Insert(ctx context.Context, event domain.GenericEvent) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := event.ID()
+	if s.exists(id) {
+		return false
+	}
+
+	if s.capacity > 0 && len(s.ordered) >= s.capacity {
+		inserted := make(chan struct{})
+		defer close(inserted)
+		go s.wakeOnDone(ctx, inserted)
+	}
+	for s.capacity > 0 && len(s.ordered) >= s.capacity {
+		logger.Warn("pending store is full, waiting for confirmations", logger.Int("capacity", s.capacity))
+		s.notFull.Wait()
+		if ctx.Err() != nil {
+			return false
+		}
+		if s.exists(id) {
+			return false
+		}
+	}
+
+	s.push(event)
+	s.changed(walInsert, event)
+	return true
+}
+
+/* inserts without waiting for room, for events that were already accepted before */
+func (s *PendingStore) insertRecovered(event domain.GenericEvent) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.exists(event.ID()) {
+		return false
+	}
+	s.push(event)
+	return true
+}
+
+func (s *PendingStore) exists(id string) bool {
+	_, pending := s.byId[id]
+	_, confirmed := s.confirmed[id]
+	return pending || confirmed
+}
+
+func (s *PendingStore) push(event domain.GenericEvent) {
+	pending := &pendingEvent{event: event}
+	heap.Push(&s.ordered, pending)
+	s.byId[event.ID()] = pending
+}
+
+func (s *PendingStore) changed(op string, event domain.GenericEvent) {
+	if s.record != nil {
+		s.record(op, event)
+	}
+}
+
+/* wakes inserts waiting for room when ctx is done */
+func (s *PendingStore) wakeOnDone(ctx context.Context, inserted chan struct{}) {
+	select {
+	case <-ctx.Done():
+		s.lock.Lock()
+		s.notFull.Broadcast()
+		s.lock.Unlock()
+	case <-inserted:
+	}
+}
+
+func (s *PendingStore) Contains(event domain.GenericEvent) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, exists := s.byId[event.ID()]
+	return exists
+}
+
+/* the stored copy of an event, which keeps fields set on intake */
+func (s *PendingStore) Get(event domain.GenericEvent) (domain.GenericEvent, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pending, exists := s.byId[event.ID()]
+	if !exists {
+		return domain.GenericEvent{}, false
+	}
+	return pending.event, true
+}
+
+func (s *PendingStore) Remove(event domain.GenericEvent) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pending, exists := s.byId[event.ID()]
+	if !exists {
+		return false
+	}
+
+	pending.event.Logger().Info("removing event", logger.Object("event", &pending.event))
+	heap.Remove(&s.ordered, pending.index)
+	delete(s.byId, event.ID())
+	s.changed(walRemove, pending.event)
+	s.notFull.Broadcast()
+	return true
+}
+
+/* moves a pending event out of confirmation, keeping it until Done is called after its delivery */
+func (s *PendingStore) Confirm(event domain.GenericEvent) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pending, exists := s.byId[event.ID()]
+	if !exists {
+		return false
+	}
+
+	pending.event.Logger().Info("event confirmed, kept until delivered", logger.Object("event", &pending.event))
+	heap.Remove(&s.ordered, pending.index)
+	delete(s.byId, event.ID())
+	s.confirmed[event.ID()] = pending.event
+	s.notFull.Broadcast()
+	return true
+}
+
+/* forgets a confirmed event once it was delivered or dropped */
+func (s *PendingStore) Done(event domain.GenericEvent) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	confirmed, exists := s.confirmed[event.ID()]
+	if !exists {
+		return false
+	}
+
+	confirmed.Logger().Info("removing delivered event")
+	delete(s.confirmed, event.ID())
+	s.changed(walRemove, confirmed)
+	return true
+}
+
+/* removes events below the confirmed block that were not found in its logs, as their blocks were replaced */
+func (s *PendingStore) RemoveLeftoverEvents(confirmedThrough *big.Int) []domain.GenericEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	removed := []domain.GenericEvent{}
+	for len(s.ordered) > 0 {
+		oldest := s.ordered[0]
+		if oldest.event.BlockNumber.Cmp(confirmedThrough) != -1 {
+			/* if oldestBlockNumber >= confirmedThrough, the rest are newer */
+			break
+		}
+		oldest.event.Logger().Info("removing leftover event", logger.Object("event", &oldest.event))
+		heap.Pop(&s.ordered)
+		delete(s.byId, oldest.event.ID())
+		s.changed(walRemove, oldest.event)
+		removed = append(removed, oldest.event)
+	}
+
+	if len(removed) > 0 {
+		s.notFull.Broadcast()
+	}
+	return removed
+}
+
+func (s *PendingStore) Events() []domain.GenericEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.events()
+}
+
+/* pending events followed by confirmed ones that were not delivered yet */
+func (s *PendingStore) retained() []domain.GenericEvent {
+	events := s.events()
+	for _, event := range s.confirmed {
+		events = append(events, event)
+	}
+	return events
+}
+
+func (s *PendingStore) events() []domain.GenericEvent {
+	ordered := make(pendingHeap, len(s.ordered))
+	copy(ordered, s.ordered)
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered.Less(i, j)
+	})
+
+	events := make([]domain.GenericEvent, len(ordered))
+	for i, pending := range ordered {
+		events[i] = pending.event
+	}
+	return events
+}
+
+type pendingHeap []*pendingEvent
+
+func (h pendingHeap) Len() int {
+	return len(h)
+}
+
+func (h pendingHeap) Less(i, j int) bool {
+	/* return i < j by block number, then log index */
+	if cmp := h[i].event.BlockNumber.Cmp(h[j].event.BlockNumber); cmp != 0 {
+		return cmp == -1
+	}
+	return h[i].event.LogIndex < h[j].event.LogIndex
+}
+
+func (h pendingHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *pendingHeap) Push(x any) {
+	pending := x.(*pendingEvent)
+	pending.index = len(*h)
+	*h = append(*h, pending)
+}
+
+func (h *pendingHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,29 @@
+package queue
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+)
+
+type Queue interface {
+	Length() int
+	FirstEventBlockNumber() *big.Int
+	Insert(ctx context.Context, event domain.GenericEvent) bool
+	Contains(event domain.GenericEvent) bool
+	Get(event domain.GenericEvent) (domain.GenericEvent, bool)
+	Remove(event domain.GenericEvent) bool
+	Confirm(event domain.GenericEvent) bool
+	Done(event domain.GenericEvent) bool
+	RemoveLeftoverEvents(confirmedThrough *big.Int) []domain.GenericEvent
+	Events() []domain.GenericEvent
+}
+
+func NewQueue() Queue {
+	if conf.GetConf().QueueDurable() {
+		return NewDurableStore()
+	}
+	return NewPendingStore()
+}
@@ -0,0 +1,230 @@
+package reconciler
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+	"github.com/sergera/star-notary-listener/internal/projection"
+	"github.com/sergera/star-notary-listener/internal/service"
+)
+
+const (
+	DriftOwner   = "owner"
+	DriftName    = "name"
+	DriftPrice   = "price"
+	DriftMissing = "missing"
+	/* on-chain tokens without delivered state in this process, which starts empty, so they are not compared */
+	DriftUnverified = "unverified"
+)
+
+type Reconciler struct {
+	projection      *projection.Projection
+	api             *service.StarNotaryAPIService
+	interval        uint64
+	sampleSize      uint64
+	emitCorrections bool
+}
+
+func NewReconciler(projection *projection.Projection) *Reconciler {
+	conf := conf.GetConf()
+	return &Reconciler{
+		projection:      projection,
+		api:             service.NewStarNotaryAPIService(),
+		interval:        conf.ReconciliationIntervalSeconds(),
+		sampleSize:      conf.ReconciliationSampleSize(),
+		emitCorrections: conf.ReconciliationEmitCorrections(),
+	}
+}
+
+/* reconciles every interval until ctx is done */
+func (r *Reconciler) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(r.interval) * time.Second):
+		}
+		r.Reconcile(ctx)
+	}
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context) map[string]int {
+	drift := map[string]int{DriftOwner: 0, DriftName: 0, DriftPrice: 0, DriftMissing: 0, DriftUnverified: 0}
+
+	for _, tokenId := range r.tokensToCheck(ctx) {
+		if ctx.Err() != nil {
+			/* interrupted, drift counts are partial */
+			break
+		}
+		r.checkToken(ctx, tokenId, drift)
+	}
+
+	logger.Info(
+		"reconciliation finished",
+		logger.Int(DriftOwner, drift[DriftOwner]),
+		logger.Int(DriftName, drift[DriftName]),
+		logger.Int(DriftPrice, drift[DriftPrice]),
+		logger.Int(DriftMissing, drift[DriftMissing]),
+		logger.Int(DriftUnverified, drift[DriftUnverified]),
+	)
+
+	return drift
+}
+
+/*
+token ids are sequential from 1, since the contract maps coordinates and names to 0 for stars that do not exist,
+and tokens are never burned, so ids 1 to the total supply are every token, enumerated on-chain rather than from
+the projection, which only holds the tokens delivered since the process started
+*/
+func (r *Reconciler) tokensToCheck(ctx context.Context) []string {
+	seen := map[string]bool{}
+	tokenIds := []string{}
+	add := func(tokenId string) {
+		if !seen[tokenId] {
+			seen[tokenId] = true
+			tokenIds = append(tokenIds, tokenId)
+		}
+	}
+
+	observe := metrics.ObserveRPC("eth_call")
+	totalSupply, err := eth.GetEth().Contract.TotalSupply(&bind.CallOpts{Context: ctx})
+	observe(err)
+	if err != nil {
+		logger.Error("could not get total supply, checking delivered tokens only", logger.String("message", err.Error()))
+	} else {
+		for id := big.NewInt(1); id.Cmp(totalSupply) <= 0; id.Add(id, big.NewInt(1)) {
+			add(id.String())
+		}
+	}
+	for _, tokenId := range r.projection.TokenIds() {
+		add(tokenId)
+	}
+
+	if r.sampleSize == 0 || uint64(len(tokenIds)) <= r.sampleSize {
+		return tokenIds
+	}
+
+	rand.Shuffle(len(tokenIds), func(i, j int) {
+		tokenIds[i], tokenIds[j] = tokenIds[j], tokenIds[i]
+	})
+	return tokenIds[:r.sampleSize]
+}
+
+func (r *Reconciler) checkToken(ctx context.Context, tokenId string, drift map[string]int) {
+	contract := eth.GetEth().Contract
+	opts := &bind.CallOpts{Context: ctx}
+
+	local, known := r.projection.Get(tokenId)
+	if !known {
+		/* nothing to compare with, correcting would deliver tokens the star notary api most likely has again */
+		drift[DriftUnverified]++
+		logger.Debug("token not delivered since start, left unverified", logger.String("tokenId", tokenId))
+		return
+	}
+	tokenIdBig, ok := new(big.Int).SetString(tokenId, 10)
+	if !ok {
+		logger.Error("could not parse token id", logger.String("tokenId", tokenId))
+		return
+	}
+
+	observe := metrics.ObserveRPC("eth_call")
+	owner, err := contract.OwnerOf(opts, tokenIdBig)
+	observe(err)
+	if err != nil {
+		/* ownerOf reverts for tokens that do not exist */
+		drift[DriftMissing]++
+		logger.Warn(
+			"drift detected",
+			logger.String("category", DriftMissing),
+			logger.String("tokenId", tokenId),
+			logger.String("message", err.Error()),
+		)
+		return
+	}
+
+	observe = metrics.ObserveRPC("eth_call")
+	star, err := contract.TokenIdToStar(opts, tokenIdBig)
+	observe(err)
+	if err != nil {
+		logger.Error("could not get star", logger.String("tokenId", tokenId), logger.String("message", err.Error()))
+		return
+	}
+
+	observe = metrics.ObserveRPC("eth_call")
+	priceInWei, err := contract.TokenIdToSalePrice(opts, tokenIdBig)
+	observe(err)
+	if err != nil {
+		logger.Error("could not get sale price", logger.String("tokenId", tokenId), logger.String("message", err.Error()))
+		return
+	}
+
+	date := time.Now().UTC().Format(time.RFC3339)
+	priceInEther := eth.WeiToEther(priceInWei)
+	corrected := local
+
+	if len(local.Owner) == 0 {
+		/* first seen through an event other than create, the delivered owner is unknown rather than drifted */
+		corrected.Owner = owner.Hex()
+	} else if !strings.EqualFold(owner.Hex(), local.Owner) {
+		drift[DriftOwner]++
+		r.report(DriftOwner, tokenId, local.Owner, owner.Hex())
+		corrected.Owner = owner.Hex()
+		if r.emitCorrections {
+			r.api.Purchase(ctx, domain.PurchaseEvent{NewOwner: owner.Hex(), TokenId: tokenId, Date: date})
+		}
+	}
+
+	if len(local.Name) == 0 {
+		/* same for a name, not delivered through a create or change name event yet */
+		corrected.Name = string(star.Name)
+	} else if string(star.Name) != local.Name {
+		drift[DriftName]++
+		r.report(DriftName, tokenId, local.Name, string(star.Name))
+		corrected.Name = string(star.Name)
+		if r.emitCorrections {
+			r.api.ChangeName(ctx, domain.ChangeNameEvent{Owner: owner.Hex(), TokenId: tokenId, NewName: string(star.Name), Date: date})
+		}
+	}
+
+	if priceInEther.Cmp(local.PriceInEther) != 0 {
+		drift[DriftPrice]++
+		r.report(DriftPrice, tokenId, local.PriceInEther.String(), priceInEther.String())
+		corrected.PriceInEther = priceInEther
+		if r.emitCorrections {
+			r.correctPrice(ctx, owner.Hex(), tokenId, priceInEther, date)
+		}
+	}
+
+	if r.emitCorrections {
+		r.projection.Set(corrected)
+	}
+}
+
+func (r *Reconciler) correctPrice(ctx context.Context, owner string, tokenId string, priceInEther *big.Float, date string) {
+	if priceInEther.Sign() == 0 {
+		r.api.RemoveFromSale(ctx, domain.RemoveFromSaleEvent{Owner: owner, TokenId: tokenId, Date: date})
+		return
+	}
+
+	generic := domain.GenericEvent{Sender: owner, TokenId: tokenId, PriceInEther: priceInEther, Date: date}
+	r.api.PutForSale(ctx, generic.ToPutForSaleEvent())
+}
+
+func (r *Reconciler) report(category string, tokenId string, delivered string, onChain string) {
+	logger.Warn(
+		"drift detected",
+		logger.String("category", category),
+		logger.String("tokenId", tokenId),
+		logger.String("delivered", delivered),
+		logger.String("onChain", onChain),
+	)
+}
@@ -0,0 +1,84 @@
+package reload
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/logger"
+)
+
+/* how often configuration files are checked for changes */
+const pollInterval = 5 * time.Second
+
+/* reloads the configuration when one of its files changes or on SIGHUP */
+type Watcher struct {
+	files    []string
+	modified map[string]time.Time
+}
+
+func NewWatcher() *Watcher {
+	w := &Watcher{files: conf.Files(), modified: map[string]time.Time{}}
+	w.changed()
+	return w
+}
+
+func (w *Watcher) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			w.changed()
+			w.reload("SIGHUP")
+		case <-ticker.C:
+			if w.changed() {
+				w.reload("file changed")
+			}
+		}
+	}
+}
+
+/* polls modification times, which also catches files swapped in place such as mounted config maps */
+func (w *Watcher) changed() bool {
+	changed := false
+	for _, file := range w.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(w.modified[file]) {
+			w.modified[file] = info.ModTime()
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (w *Watcher) reload(reason string) {
+	applied, rejected, err := conf.Reload()
+	if err != nil {
+		logger.Error("configuration not reloaded, keeping the current one", logger.String("reason", reason), logger.String("message", err.Error()))
+		return
+	}
+
+	for _, key := range rejected {
+		logger.Error("configuration change needs a restart, keeping the current value", logger.String("key", key))
+	}
+	for _, setting := range applied {
+		logger.Info("configuration change applied", logger.String("key", setting.Key), logger.String("value", setting.Value), logger.String("source", setting.Source))
+	}
+	if err := logger.SetLevel(conf.GetConf().LogLevel()); err != nil {
+		logger.Error("could not set log level", logger.String("message", err.Error()))
+	}
+	logger.Info("configuration reloaded", logger.String("reason", reason), logger.Int("applied", len(applied)), logger.Int("rejected", len(rejected)))
+}
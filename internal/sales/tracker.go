@@ -0,0 +1,239 @@
+package sales
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/enrichment"
+	"github.com/sergera/star-notary-listener/internal/eth"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+)
+
+/* events that open and close a listing */
+var (
+	putForSaleTopic     = common.HexToHash("0xeef8701c784dcc5b12eb5ce2687a9e42d1d94b6e81f660dcb84b51554c37f082")
+	removeFromSaleTopic = common.HexToHash("0xbfbf7e7677a0c423106146f1ee86ac042526b53581de06ba54c51e8acfeac746")
+	purchaseTopic       = common.HexToHash("0x2499a5330ab0979cc612135e7883ebc3cd5c9f7a8508f042540c34723348f632")
+)
+
+/* blocks searched back from a purchase for the listing it closed, a page at a time */
+const (
+	listingSearchBlocks = 10000
+	listingPageBlocks   = 2000
+)
+
+type listing struct {
+	seller       string
+	priceInWei   *big.Int
+	priceInEther *big.Float
+	listedAt     string
+}
+
+/* follows each token from PutForSale to Purchase, so purchases can be attributed a seller and price */
+type Tracker struct {
+	lock     *sync.Mutex
+	listings map[string]listing
+	caller   *enrichment.PinnedCaller
+}
+
+func NewTracker(caller *enrichment.PinnedCaller) *Tracker {
+	return &Tracker{
+		lock:     &sync.Mutex{},
+		listings: map[string]listing{},
+		caller:   caller,
+	}
+}
+
+/* must be called with confirmed events in (block, log index) order */
+func (t *Tracker) Track(ctx context.Context, event *domain.GenericEvent) {
+	switch event.EventType {
+	case "PutForSale":
+		t.lock.Lock()
+		t.listings[event.TokenId] = listing{
+			seller:       event.Sender,
+			priceInWei:   event.PriceInWei,
+			priceInEther: event.PriceInEther,
+			listedAt:     event.Date,
+		}
+		t.lock.Unlock()
+	case "RemoveFromSale":
+		t.lock.Lock()
+		delete(t.listings, event.TokenId)
+		t.lock.Unlock()
+	case "Purchase":
+		t.attribute(ctx, event)
+		t.lock.Lock()
+		delete(t.listings, event.TokenId)
+		t.lock.Unlock()
+	}
+}
+
+/* attributes a purchase from the chain alone, without following listings */
+/* used for events delivered again out of order, which must not change tracked listings */
+func (t *Tracker) AttributeFromChain(ctx context.Context, event *domain.GenericEvent) {
+	if event.EventType != "Purchase" {
+		return
+	}
+	t.attributeFromChain(ctx, event)
+}
+
+func (t *Tracker) attribute(ctx context.Context, event *domain.GenericEvent) {
+	t.lock.Lock()
+	sale, found := t.listings[event.TokenId]
+	t.lock.Unlock()
+
+	if !found {
+		/* listing happened before this process started, read it from the chain */
+		t.attributeFromChain(ctx, event)
+		return
+	}
+
+	event.Seller = sale.seller
+	event.PriceInWei = sale.priceInWei
+	event.PriceInEther = sale.priceInEther
+	event.ListedAt = sale.listedAt
+}
+
+/*
+attributes a purchase to the listing event it closed, found in the logs before it, same block included, so the
+listing date is known, a listing older than the search is read from the state at the block before the purchase
+*/
+func (t *Tracker) attributeFromChain(ctx context.Context, event *domain.GenericEvent) {
+	sale, searched, err := t.listingFromLogs(ctx, event)
+	if err == nil && !searched {
+		sale, err = t.listingAtPreviousBlock(ctx, event)
+	}
+	if err != nil {
+		logger.Error(
+			"could not attribute purchase to a sale",
+			logger.String("message", err.Error()),
+			logger.String("tokenId", event.TokenId),
+			logger.String("txHash", event.TxHash),
+		)
+		return
+	}
+	if sale.priceInWei == nil || sale.priceInWei.Sign() == 0 {
+		/* a token that was not for sale has no sale to attribute */
+		logger.Warn(
+			"purchased token was not listed before the purchase, not attributing a sale",
+			logger.String("tokenId", event.TokenId),
+			logger.String("txHash", event.TxHash),
+		)
+		return
+	}
+
+	event.Seller = sale.seller
+	event.PriceInWei = sale.priceInWei
+	event.PriceInEther = sale.priceInEther
+	event.ListedAt = sale.listedAt
+}
+
+/*
+the last listing event of the token before the purchase, with an empty listing if the last one closed it,
+searched is false if none was emitted within listingSearchBlocks of the purchase
+*/
+func (t *Tracker) listingFromLogs(ctx context.Context, event *domain.GenericEvent) (sale listing, searched bool, err error) {
+	contract := eth.GetEth().Contract
+	oldest := new(big.Int).Sub(event.BlockNumber, big.NewInt(listingSearchBlocks-1))
+	if oldest.Sign() < 0 {
+		oldest.SetInt64(0)
+	}
+
+	for end := new(big.Int).Set(event.BlockNumber); end.Cmp(oldest) >= 0; end = new(big.Int).Sub(end, big.NewInt(listingPageBlocks)) {
+		start := new(big.Int).Sub(end, big.NewInt(listingPageBlocks-1))
+		if start.Cmp(oldest) == -1 {
+			start.Set(oldest)
+		}
+
+		observe := metrics.ObserveRPC("eth_getLogs")
+		logs, err := eth.GetEth().Client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: start,
+			ToBlock:   end,
+			Addresses: []common.Address{common.HexToAddress(conf.GetConf().ContractAddress())},
+			Topics:    [][]common.Hash{{putForSaleTopic, removeFromSaleTopic, purchaseTopic}},
+		})
+		observe(err)
+		if err != nil {
+			return listing{}, false, err
+		}
+
+		/* logs come in (block, log index) order, the last one before the purchase decides */
+		for i := len(logs) - 1; i >= 0; i-- {
+			log := logs[i]
+			if log.Removed || (log.BlockNumber == event.BlockNumber.Uint64() && log.Index >= event.LogIndex) {
+				continue
+			}
+
+			switch log.Topics[0] {
+			case putForSaleTopic:
+				putForSale, err := contract.ParsePutForSale(log)
+				if err != nil {
+					return listing{}, false, err
+				}
+				if putForSale.TokenId.String() != event.TokenId {
+					continue
+				}
+				header, err := eth.HeaderByNumber(ctx, new(big.Int).SetUint64(log.BlockNumber))
+				if err != nil {
+					return listing{}, false, err
+				}
+				return listing{
+					seller:       putForSale.Owner.Hex(),
+					priceInWei:   putForSale.PriceInWei,
+					priceInEther: eth.WeiToEther(putForSale.PriceInWei),
+					listedAt:     time.Unix(int64(header.Time), 0).Format(time.RFC3339),
+				}, true, nil
+			case removeFromSaleTopic:
+				removeFromSale, err := contract.ParseRemoveFromSale(log)
+				if err != nil {
+					return listing{}, false, err
+				}
+				if removeFromSale.TokenId.String() == event.TokenId {
+					return listing{}, true, nil
+				}
+			case purchaseTopic:
+				purchase, err := contract.ParsePurchase(log)
+				if err != nil {
+					return listing{}, false, err
+				}
+				if purchase.TokenId.String() == event.TokenId {
+					return listing{}, true, nil
+				}
+			}
+		}
+	}
+
+	return listing{}, false, nil
+}
+
+func (t *Tracker) listingAtPreviousBlock(ctx context.Context, event *domain.GenericEvent) (listing, error) {
+	tokenId, ok := new(big.Int).SetString(event.TokenId, 10)
+	if !ok {
+		return listing{}, fmt.Errorf("could not parse token id: %s", event.TokenId)
+	}
+	previousBlock := new(big.Int).Sub(event.BlockNumber, big.NewInt(1))
+
+	priceInWei, err := t.caller.TokenIdToSalePrice(ctx, tokenId, previousBlock)
+	if err != nil {
+		return listing{}, err
+	}
+
+	seller, err := t.caller.OwnerOf(ctx, tokenId, previousBlock)
+	if err != nil {
+		return listing{}, err
+	}
+
+	return listing{
+		seller:       seller,
+		priceInWei:   priceInWei,
+		priceInEther: eth.WeiToEther(priceInWei),
+	}, nil
+}
@@ -2,35 +2,55 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/sergera/star-notary-listener/internal/conf"
 	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/journal"
 	"github.com/sergera/star-notary-listener/internal/logger"
+	"github.com/sergera/star-notary-listener/internal/metrics"
+	"github.com/sergera/star-notary-listener/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type StarNotaryAPIService struct {
-	host        string
-	port        string
 	contentType string
 	client      *http.Client
+	journal     *journal.Journal
 }
 
+/* requests are also cancelled with their context, the timeout bounds the ones whose context is not */
 func NewStarNotaryAPIService() *StarNotaryAPIService {
-	conf := conf.GetConf()
 	return &StarNotaryAPIService{
-		conf.StarNotaryAPIHost(),
-		conf.StarNotaryAPIPort(),
 		"application/json; charset=UTF-8",
-		&http.Client{},
+		&http.Client{Timeout: time.Duration(conf.GetConf().StarNotaryAPITimeoutSeconds()) * time.Second},
+		journal.GetJournal(),
 	}
 }
 
-func (b StarNotaryAPIService) Post(route string, jsonData []byte) error {
-	request, err := http.NewRequest("POST", b.host+":"+b.port+"/"+route, bytes.NewBuffer(jsonData))
+/* read on every request, since host and port can be reloaded */
+func (b StarNotaryAPIService) url(route string) string {
+	conf := conf.GetConf()
+	return conf.StarNotaryAPIHost() + ":" + conf.StarNotaryAPIPort() + "/" + route
+}
+
+func (b StarNotaryAPIService) Post(ctx context.Context, route string, jsonData []byte) (err error) {
+	observe := metrics.ObserveDelivery(route)
+	ctx, span := tracing.Start(ctx, "POST /"+route, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		tracing.Route.String(route),
+	))
+	defer func() {
+		observe(err)
+		tracing.End(span, err)
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", b.url(route), bytes.NewBuffer(jsonData))
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed to create post request",
 			logger.String("message", err.Error()),
 		)
@@ -38,26 +58,45 @@ func (b StarNotaryAPIService) Post(route string, jsonData []byte) error {
 	}
 
 	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	tracing.InjectHeader(ctx, request.Header)
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	sentAt := time.Now()
+	response, err := b.client.Do(request)
+	b.record(ctx, "POST", route, jsonData, sentAt, response, err)
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed post request",
 			logger.String("message", err.Error()),
-			logger.String("status", response.Status),
 		)
 		return err
 	}
 
 	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		logger.FromContext(ctx).Error(
+			"unsuccessful post request",
+			logger.String("route", route),
+			logger.String("status", response.Status),
+		)
+		return fmt.Errorf("unsuccessful post request to %s: %s", route, response.Status)
+	}
+
 	return nil
 }
 
-func (b StarNotaryAPIService) Put(route string, jsonData []byte) error {
-	request, err := http.NewRequest("PUT", b.host+":"+b.port+"/"+route, bytes.NewBuffer(jsonData))
+func (b StarNotaryAPIService) Put(ctx context.Context, route string, jsonData []byte) (err error) {
+	observe := metrics.ObserveDelivery(route)
+	ctx, span := tracing.Start(ctx, "PUT /"+route, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		tracing.Route.String(route),
+	))
+	defer func() {
+		observe(err)
+		tracing.End(span, err)
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, "PUT", b.url(route), bytes.NewBuffer(jsonData))
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed to create put request",
 			logger.String("message", err.Error()),
 		)
@@ -65,26 +104,52 @@ func (b StarNotaryAPIService) Put(route string, jsonData []byte) error {
 	}
 
 	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	tracing.InjectHeader(ctx, request.Header)
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	sentAt := time.Now()
+	response, err := b.client.Do(request)
+	b.record(ctx, "PUT", route, jsonData, sentAt, response, err)
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed put request",
 			logger.String("message", err.Error()),
-			logger.String("status", response.Status),
 		)
 		return err
 	}
 
 	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		logger.FromContext(ctx).Error(
+			"unsuccessful put request",
+			logger.String("route", route),
+			logger.String("status", response.Status),
+		)
+		return fmt.Errorf("unsuccessful put request to %s: %s", route, response.Status)
+	}
+
 	return nil
 }
 
-func (b StarNotaryAPIService) CreateStar(e domain.CreateEvent) error {
+/* any response counts, only whether the api can be reached is checked */
+func (b StarNotaryAPIService) Reachable(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", b.url(""), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (b StarNotaryAPIService) CreateStar(ctx context.Context, e domain.CreateEvent) error {
 	m, err := json.Marshal(e)
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed to marshal event model into json",
 			logger.String("message", err.Error()),
 			logger.Object("event", &e),
@@ -92,7 +157,7 @@ func (b StarNotaryAPIService) CreateStar(e domain.CreateEvent) error {
 		return err
 	}
 
-	err = b.Post("create", m)
+	err = b.Post(ctx, "create", m)
 	if err != nil {
 		return err
 	}
@@ -100,10 +165,10 @@ func (b StarNotaryAPIService) CreateStar(e domain.CreateEvent) error {
 	return nil
 }
 
-func (b StarNotaryAPIService) ChangeName(e domain.ChangeNameEvent) error {
+func (b StarNotaryAPIService) ChangeName(ctx context.Context, e domain.ChangeNameEvent) error {
 	m, err := json.Marshal(e)
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed to marshal event model into json",
 			logger.String("message", err.Error()),
 			logger.Object("event", &e),
@@ -111,7 +176,7 @@ func (b StarNotaryAPIService) ChangeName(e domain.ChangeNameEvent) error {
 		return err
 	}
 
-	err = b.Put("set-name", m)
+	err = b.Put(ctx, "set-name", m)
 	if err != nil {
 		return err
 	}
@@ -119,10 +184,10 @@ func (b StarNotaryAPIService) ChangeName(e domain.ChangeNameEvent) error {
 	return nil
 }
 
-func (b StarNotaryAPIService) PutForSale(e domain.PutForSaleEvent) error {
+func (b StarNotaryAPIService) PutForSale(ctx context.Context, e domain.PutForSaleEvent) error {
 	m, err := json.Marshal(e)
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed to marshal event model into json",
 			logger.String("message", err.Error()),
 			logger.Object("event", &e),
@@ -130,7 +195,7 @@ func (b StarNotaryAPIService) PutForSale(e domain.PutForSaleEvent) error {
 		return err
 	}
 
-	err = b.Put("set-price", m)
+	err = b.Put(ctx, "set-price", m)
 	if err != nil {
 		return err
 	}
@@ -138,10 +203,10 @@ func (b StarNotaryAPIService) PutForSale(e domain.PutForSaleEvent) error {
 	return nil
 }
 
-func (b StarNotaryAPIService) RemoveFromSale(e domain.RemoveFromSaleEvent) error {
+func (b StarNotaryAPIService) RemoveFromSale(ctx context.Context, e domain.RemoveFromSaleEvent) error {
 	m, err := json.Marshal(e)
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed to marshal event model into json",
 			logger.String("message", err.Error()),
 			logger.Object("event", &e),
@@ -149,7 +214,7 @@ func (b StarNotaryAPIService) RemoveFromSale(e domain.RemoveFromSaleEvent) error
 		return err
 	}
 
-	err = b.Put("remove-from-sale", m)
+	err = b.Put(ctx, "remove-from-sale", m)
 	if err != nil {
 		return err
 	}
@@ -157,10 +222,10 @@ func (b StarNotaryAPIService) RemoveFromSale(e domain.RemoveFromSaleEvent) error
 	return nil
 }
 
-func (b StarNotaryAPIService) Purchase(e domain.PurchaseEvent) error {
+func (b StarNotaryAPIService) Purchase(ctx context.Context, e domain.PurchaseEvent) error {
 	m, err := json.Marshal(e)
 	if err != nil {
-		logger.Error(
+		logger.FromContext(ctx).Error(
 			"failed to marshal event model into json",
 			logger.String("message", err.Error()),
 			logger.Object("event", &e),
@@ -168,10 +233,53 @@ func (b StarNotaryAPIService) Purchase(e domain.PurchaseEvent) error {
 		return err
 	}
 
-	err = b.Put("purchase", m)
+	err = b.Put(ctx, "purchase", m)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (b StarNotaryAPIService) Retract(ctx context.Context, e domain.RetractEvent) error {
+	m, err := json.Marshal(e)
+	if err != nil {
+		logger.FromContext(ctx).Error(
+			"failed to marshal event model into json",
+			logger.String("message", err.Error()),
+			logger.Object("event", &e),
+		)
+		return err
+	}
+
+	err = b.Post(ctx, "retract", m)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/* journals every request made, failed ones included, as what was told to the api */
+func (b StarNotaryAPIService) record(ctx context.Context, method string, route string, payload []byte, sentAt time.Time, response *http.Response, err error) {
+	if b.journal == nil {
+		return
+	}
+	entry := journal.Entry{
+		EventID:     journal.EventID(ctx),
+		Method:      method,
+		Route:       route,
+		Payload:     payload,
+		SentAt:      journal.Timestamp(sentAt),
+		RespondedAt: journal.Timestamp(time.Now()),
+	}
+	if response != nil {
+		entry.Status = response.StatusCode
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := b.journal.Record(entry); err != nil {
+		logger.FromContext(ctx).Error("could not record request in journal", logger.String("message", err.Error()), logger.String("route", route))
+	}
+}
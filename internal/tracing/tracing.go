@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sergera/star-notary-listener/internal/conf"
+	"github.com/sergera/star-notary-listener/internal/domain"
+	"github.com/sergera/star-notary-listener/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+const serviceName = "star-notary-listener"
+
+const traceFileName = "star-notary-listener-traces.json"
+
+const traceParentKey = "traceparent"
+
+/* shared attribute keys */
+var (
+	EventType   = attribute.Key("event.type")
+	TokenId     = attribute.Key("event.token_id")
+	TxHash      = attribute.Key("event.tx_hash")
+	BlockNumber = attribute.Key("event.block_number")
+	LogIndex    = attribute.Key("event.log_index")
+	Status      = attribute.Key("event.status")
+	Removed     = attribute.Key("event.removed")
+	Inserted    = attribute.Key("queue.inserted")
+	FromBlock   = attribute.Key("confirmation.from_block")
+	ToBlock     = attribute.Key("confirmation.to_block")
+	Policy      = attribute.Key("confirmation.policy")
+	Route       = attribute.Key("http.route")
+)
+
+var propagator = propagation.TraceContext{}
+
+var tracer trace.Tracer = trace.NewNoopTracerProvider().Tracer(serviceName)
+
+var shutdown = func(ctx context.Context) error { return nil }
+
+/* installs the configured exporter, spans are dropped with the none exporter */
+func Setup() {
+	conf := conf.GetConf()
+	otel.SetTextMapPropagator(propagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch conf.TracingExporter() {
+	case ExporterNone:
+		return
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		var file *os.File
+		file, err = os.OpenFile(filepath.Join(conf.TracingPath(), traceFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		}
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(
+			context.Background(),
+			otlptracehttp.WithEndpoint(conf.TracingOTLPEndpoint()),
+			otlptracehttp.WithInsecure(),
+		)
+	}
+	if err != nil {
+		logger.Panic("could not create trace exporter", logger.String("exporter", conf.TracingExporter()), logger.String("message", err.Error()))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	tracer = provider.Tracer(serviceName)
+	shutdown = provider.Shutdown
+}
+
+/* exports spans still buffered */
+func Shutdown(ctx context.Context) {
+	if err := shutdown(ctx); err != nil {
+		logger.Error("could not flush traces", logger.String("message", err.Error()))
+	}
+}
+
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, opts...)
+}
+
+/* W3C traceparent of the span in ctx, empty if there is none */
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier[traceParentKey]
+}
+
+/* ctx carrying the span of a traceparent, so spans started from it join its trace */
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier{traceParentKey: traceParent})
+}
+
+/* records err, if any, on span and ends it */
+func End(span trace.Span, err error, opts ...trace.SpanEndOption) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(opts...)
+}
+
+func EventAttributes(event *domain.GenericEvent) trace.SpanStartEventOption {
+	return trace.WithAttributes(
+		EventType.String(event.EventType),
+		TokenId.String(event.TokenId),
+		TxHash.String(event.TxHash),
+		BlockNumber.String(event.BlockNumber.String()),
+		LogIndex.Int64(int64(event.LogIndex)),
+	)
+}
+
+/* adds the traceparent header of the span in ctx to an outbound request */
+func InjectHeader(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}